@@ -0,0 +1,202 @@
+// SPDX-FileCopyrightText: © 2021 Ulrich Kunitz
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// ArgSpec describes a positional argument of a command.
+type ArgSpec struct {
+	// Name of the argument (e.g. "file")
+	Name string
+	// Description of the argument; it will be formatted.
+	Description string
+	// Optional marks arguments that may be omitted.
+	Optional bool
+	// Variadic marks an argument that may be repeated. Only the last
+	// argument of a command should be variadic.
+	Variadic bool
+	// SetValue is called for each argument matched by the spec. It may be
+	// nil.
+	SetValue func(arg string) error
+}
+
+// Usage returns the short form of the argument as used in usage lines, e.g.
+// <file>, [<file>] or <file>...
+func (spec *ArgSpec) Usage() string {
+	s := "<" + spec.Name + ">"
+	if spec.Variadic {
+		s += "..."
+	}
+	if spec.Optional {
+		s = "[" + s + "]"
+	}
+	return s
+}
+
+// checkArgs verifies the arguments against the positional argument specs of
+// the command. The check is skipped if the command has no specs. If the
+// arguments are exhausted, the first required spec following is reported as
+// missing.
+func checkArgs(cmd *Command, args []string) error {
+	specs := cmd.PositionalArgs
+	if len(specs) == 0 {
+		return nil
+	}
+	i := 0
+	for j := range specs {
+		spec := &specs[j]
+		if i >= len(args) {
+			if spec.Optional {
+				continue
+			}
+			return &CommandError{
+				Name: cmd.Name,
+				Message: fmt.Sprintf("argument %s is required",
+					spec.Usage()),
+			}
+		}
+		k := i + 1
+		if spec.Variadic {
+			k = len(args)
+		}
+		for ; i < k; i++ {
+			if spec.SetValue == nil {
+				continue
+			}
+			if err := spec.SetValue(args[i]); err != nil {
+				return &CommandError{
+					Name: cmd.Name,
+					Message: fmt.Sprintf(
+						"invalid value %q for argument <%s>",
+						args[i], spec.Name),
+					Wrapped: err,
+				}
+			}
+		}
+	}
+	if i < len(args) {
+		return &CommandError{
+			Name:    cmd.Name,
+			Message: fmt.Sprintf("unexpected argument %q", args[i]),
+		}
+	}
+	return nil
+}
+
+// SplitArgs splits s into arguments similar to a POSIX shell but without any
+// expansions. Arguments are separated by white space. Single quotes preserve
+// the literal value of all characters enclosed. Double quotes preserve the
+// value of all characters except the backslash, which escapes a double quote
+// or a backslash. Outside of quotes a backslash escapes any character.
+func SplitArgs(s string) (args []string, err error) {
+	var (
+		sb    strings.Builder
+		inArg bool
+		quote rune
+		esc   bool
+	)
+	for _, c := range s {
+		switch {
+		case esc:
+			if quote == '"' && c != '"' && c != '\\' {
+				sb.WriteRune('\\')
+			}
+			sb.WriteRune(c)
+			esc = false
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			} else {
+				sb.WriteRune(c)
+			}
+		case c == '\\':
+			esc = true
+			inArg = true
+		case quote == '"':
+			if c == '"' {
+				quote = 0
+			} else {
+				sb.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inArg = true
+		case unicode.IsSpace(c):
+			if inArg {
+				args = append(args, sb.String())
+				sb.Reset()
+				inArg = false
+			}
+		default:
+			sb.WriteRune(c)
+			inArg = true
+		}
+	}
+	if esc {
+		return nil, errors.New("trailing backslash")
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote %c", quote)
+	}
+	if inArg {
+		args = append(args, sb.String())
+	}
+	return args, nil
+}
+
+// Positionals splits args at the first argument "--", which is not included in
+// any of the returned slices. The arguments following it are returned
+// literally in after. If args doesn't contain "--", before is args and after
+// is nil. As in ParseOptions, arguments following "--" are never interpreted
+// as options.
+func Positionals(args []string) (before, after []string) {
+	for i, a := range args {
+		if a == "--" {
+			return args[:i], args[i+1:]
+		}
+	}
+	return args, nil
+}
+
+// synopsis generates a usage line from the command name, its options and its
+// positional arguments.
+func (cmd *Command) synopsis() string {
+	var sb strings.Builder
+	sb.WriteString(cmd.Name)
+	if !cmd.NoOptions &&
+		(len(cmd.Options) > 0 || len(cmd.PersistentOptions) > 0) {
+		sb.WriteString(" [options]")
+	}
+	for i := range cmd.PositionalArgs {
+		sb.WriteByte(' ')
+		sb.WriteString(cmd.PositionalArgs[i].Usage())
+	}
+	return sb.String()
+}
+
+// usageArgs writes the list of positional arguments. The usage of the argument
+// will be preceded by indent1 and the description by indent1+indent2.
+func usageArgs(w io.Writer, args []ArgSpec, indent1, indent2 string) (n int, err error) {
+	for i := range args {
+		spec := &args[i]
+		k, err := fmt.Fprintf(w, "%s%s\n", indent1, spec.Usage())
+		n += k
+		if err != nil {
+			return n, err
+		}
+		k, err = FormatText(w, spec.Description, 80, indent1+indent2)
+		n += k
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
@@ -44,8 +44,12 @@ help command.
 package cli
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"os"
+	"os/exec"
 	"sort"
 	"strings"
 	"unicode/utf8"
@@ -69,35 +73,353 @@ import (
 type Command struct {
 	// Name of command usually short (e.g. "list")
 	Name string
+	// Alternative names for the command (e.g. "ls")
+	Names []string
 	// Short description of the command (e.g. "list all config parameters")
 	Info string
 	// The usage string may have multiple lines.
 	Usage string
 	// Longer description that will be formatted.
 	Description string
+	// Version of the program printed by the version option. Only the field
+	// of the root command is used.
+	Version string
 	// Options list. Note these options must immediately follow the
 	// command in the command line and any non-option will stop the
 	// processing of the options for this command.
 	Options []*Option
+	// PersistentOptions are accepted by the command and all its
+	// subcommands. The names of persistent options must not collide with
+	// the options of the subcommands.
+	PersistentOptions []*Option
+	// Positional arguments of the command. They are used for the
+	// documentation of the command. If the list is not empty, Run checks
+	// the arguments against it before calling Exec.
+	PositionalArgs []ArgSpec
 	// List of all subcommands for this command.
 	Subcommands []*Command
+	// SubcommandProvider supports subcommands that are only known at
+	// runtime, e.g. plugins. It is called once, when Parse, Run or
+	// WriteDoc need the subcommands of the command for the first time, and
+	// its result is appended to Subcommands. Provided commands having the
+	// name of a static subcommand are ignored.
+	SubcommandProvider func() []*Command
+	// Hidden commands are not listed in the documentation of the parent
+	// command, but they can be executed.
+	Hidden bool
+	// ResolveCommand is called if an argument is the prefix of the names of
+	// multiple subcommands. It may return one of the candidates or an
+	// error. If it is nil, Parse reports an error.
+	ResolveCommand func(candidates []*Command, arg string) (*Command, error)
+	// DisableDashDash lets the option parsing for the command stop at "--"
+	// without consuming it, so that Exec receives it as argument. By
+	// default "--" terminates the options and is removed.
+	DisableDashDash bool
+	// LenientBooleans lets boolean flags of the command, e.g. those created
+	// by BoolOption, accept a value attached to their long names, e.g.
+	// --flag=false. The value is parsed by strconv.ParseBool. Short
+	// options and negated names are not affected.
+	LenientBooleans bool
+	// NoOptions declares that the command accepts no options. Parse
+	// reports an error if an argument starting with a dash follows the
+	// command instead of passing it to Exec. The argument "-" and the
+	// arguments following "--" are accepted.
+	NoOptions bool
+	// FuzzyCommands lets Parse select a subcommand whose name contains
+	// the characters of the argument in the same order, e.g. "instl" for
+	// "install", if no name starts with the argument. Names starting with
+	// the first character of the argument are preferred. Multiple matches
+	// are resolved by ResolveCommand or reported as error.
+	FuzzyCommands bool
+	// StrictSubcommands requires that an argument following the options
+	// of the command matches a subcommand. Otherwise the remaining
+	// arguments are passed to Exec.
+	StrictSubcommands bool
 	// Function that executes the command.
 	Exec func(args []string) error
+	// ExecContext executes the command with the context given to
+	// RunContext. It is used instead of Exec if it is set.
+	ExecContext func(ctx context.Context, args []string) error
+	// ExecCode executes the command and returns the exit code for the
+	// process. It is used instead of Exec and ExecContext if it is set.
+	// See RunCode.
+	ExecCode func(args []string) int
+	// Output receives the help and version information printed for the
+	// command. If it is nil, the output of the parent command is used and
+	// os.Stdout for the root command.
+	Output io.Writer
+	// PromptRequired lets Run prompt for missing required options of
+	// the command and its ancestors if the standard input is a terminal.
+	// See PromptMissing. Otherwise the missing options are reported as
+	// errors.
+	PromptRequired bool
+	// RequiredEnv lists environment variables that must be set before
+	// Run executes the command or one of its subcommands. The check is
+	// skipped if help has been requested.
+	RequiredEnv []string
+	// Aliases maps names to argument strings that replace the name if it is
+	// found in the position of a subcommand, e.g. "co": "checkout --quiet".
+	// The strings are split by SplitArgs. Subcommand names take
+	// precedence over aliases and aliases over prefixes of subcommand
+	// names. The expansion of an alias is not expanded again. Aliases are
+	// expanded by Run but not by Parse.
+	Aliases map[string]string
+	// Rewrite may transform the arguments before Run parses them, e.g. to
+	// expand aliases. Only the field of the root command is used.
+	Rewrite func(args []string) ([]string, error)
+	// Debug receives a trace of the commands and options matched by Parse
+	// if it is not nil. Only the Debug field of the root command is used.
+	Debug io.Writer
+	// StopOnFirstError lets Parse return at the first option error
+	// without setting the values of the options following it. By default
+	// all option errors are collected. Only the field of the root command
+	// is used.
+	StopOnFirstError bool
+	// Diagnostics collects the warnings of Parse and Run, e.g. for
+	// deprecated options, if it is not nil. Otherwise the warnings are
+	// printed to standard error. RunMain writes the collected diagnostics
+	// to its error output. Only the field of the root command is used.
+	Diagnostics *Diagnostics
+	// HelpReturnsError lets the help command and the help option return
+	// ErrHelpRequested after the help has been printed, so that Run
+	// reports that no regular command has been executed. RunCode maps the
+	// error to ExitOK. Only the field of the root command is used.
+	HelpReturnsError bool
+	// ExternalPrefix enables the execution of external programs as
+	// subcommands. If the first argument following the options of the root
+	// command doesn't match a subcommand and the root command has no Exec
+	// function, Run looks for an executable with the name ExternalPrefix
+	// followed by the argument in the directories of PATH and runs it with
+	// the remaining arguments. A typical prefix is "foo-" for the program
+	// foo. Only the field of the root command is used.
+	ExternalPrefix string
+	// DefaultConfig lets Run load the options of the commands selected
+	// from the file DefaultConfigPath(Name) if it exists and no option
+	// named config has been given. The file ranks below the command line
+	// and the environment variables. Options of the other commands of the
+	// tree are ignored. See LoadOptionsFile for the format. Only the field
+	// of the root command is used.
+	DefaultConfig bool
+
+	// parent is the command that selected this command during the last
+	// call of Parse.
+	parent *Command
+	// provided records that SubcommandProvider has been called.
+	provided bool
+	// helpOnly marks an Exec function installed by AddHelpOption that only
+	// prints the help.
+	helpOnly bool
+	// help marks the help command added by AddHelpCommand.
+	help bool
+	// dryRun is the flag of the option added by AddDryRunOption.
+	dryRun *bool
+}
+
+// loadSubcommands appends the subcommands of the SubcommandProvider to
+// Subcommands on the first call. Provided commands with the name of a static
+// subcommand are ignored.
+func (cmd *Command) loadSubcommands() {
+	if cmd.provided || cmd.SubcommandProvider == nil {
+		return
+	}
+	cmd.provided = true
+	static := cmd.Subcommands
+	for _, c := range cmd.SubcommandProvider() {
+		if _, ok := findCommand(static, c.Name); ok {
+			continue
+		}
+		cmd.Subcommands = append(cmd.Subcommands, c)
+	}
+}
+
+// hasExec reports whether the command has a function executing it.
+func (cmd *Command) hasExec() bool {
+	return cmd.Exec != nil || cmd.ExecContext != nil || cmd.ExecCode != nil
+}
+
+// localOptions returns the options of the command and its persistent options.
+func (cmd *Command) localOptions() []*Option {
+	options := make([]*Option, 0,
+		len(cmd.Options)+len(cmd.PersistentOptions))
+	options = append(options, cmd.Options...)
+	return append(options, cmd.PersistentOptions...)
+}
+
+// rootCommand returns the root of the commands selected by the last call of
+// Parse.
+func (cmd *Command) rootCommand() *Command {
+	for cmd.parent != nil {
+		cmd = cmd.parent
+	}
+	return cmd
+}
+
+// output returns the writer for the help output of the command. The parents are
+// known after the command has been selected by Parse.
+func (cmd *Command) output() io.Writer {
+	for c := cmd; c != nil; c = c.parent {
+		if c.Output != nil {
+			return c.Output
+		}
+	}
+	return os.Stdout
+}
+
+// inheritedOptions returns the persistent options of the parents of the
+// command. The parents are known after the command has been selected by Parse.
+func (cmd *Command) inheritedOptions() []*Option {
+	var options []*Option
+	for c := cmd.parent; c != nil; c = c.parent {
+		options = append(options, c.PersistentOptions...)
+	}
+	return options
+}
+
+// AllNames returns the name and the alternative names of the command.
+func (cmd *Command) AllNames() []string {
+	n := len(cmd.Names)
+	if cmd.Name != "" {
+		n++
+	}
+	s := make([]string, 0, n)
+	if cmd.Name != "" {
+		s = append(s, cmd.Name)
+	}
+	s = append(s, cmd.Names...)
+	return s
+}
+
+func (cmd *Command) hasName(name string) bool {
+	if name == "" {
+		return false
+	}
+	if name == cmd.Name {
+		return true
+	}
+	for _, n := range cmd.Names {
+		if n == name {
+			return true
+		}
+	}
+	return false
 }
 
 func findCommand(commands []*Command, name string) (cmd *Command, ok bool) {
 	for _, cmd := range commands {
-		if cmd.Name == name {
+		if cmd.hasName(name) {
 			return cmd, true
 		}
 	}
 	return nil, false
 }
 
+// matchCommands returns all commands that have a name or alternative name
+// starting with arg.
+func matchCommands(commands []*Command, arg string) []*Command {
+	var candidates []*Command
+	for _, c := range commands {
+		for _, name := range c.AllNames() {
+			if strings.HasPrefix(name, arg) {
+				candidates = append(candidates, c)
+				break
+			}
+		}
+	}
+	return candidates
+}
+
+// matchSubcommand finds the subcommand that has arg as name or alternative
+// name or, if there is none, a name starting with arg. It returns nil if there
+// is no such command. Ambiguous matches are resolved by ResolveCommand or
+// reported as error.
+func (cmd *Command) matchSubcommand(arg string) (*Command, error) {
+	cmd.loadSubcommands()
+	if c, ok := findCommand(cmd.Subcommands, arg); ok {
+		return c, nil
+	}
+	candidates := matchCommands(cmd.Subcommands, arg)
+	if len(candidates) == 0 && cmd.FuzzyCommands {
+		candidates = fuzzyMatchCommands(cmd.Subcommands, arg)
+	}
+	switch len(candidates) {
+	case 0:
+		return nil, nil
+	case 1:
+		return candidates[0], nil
+	}
+	if cmd.ResolveCommand != nil {
+		return cmd.ResolveCommand(candidates, arg)
+	}
+	names := make([]string, len(candidates))
+	for i, c := range candidates {
+		names[i] = c.Name
+	}
+	return nil, &CommandError{
+		Name: cmd.Name,
+		Message: fmt.Sprintf("ambiguous command %s; candidates are %s",
+			arg, strings.Join(names, ", ")),
+	}
+}
+
+// isSubsequence reports whether the runes of s appear in t in the same order.
+func isSubsequence(s, t string) bool {
+	for _, r := range t {
+		if s == "" {
+			break
+		}
+		c, size := utf8.DecodeRuneInString(s)
+		if c == r {
+			s = s[size:]
+		}
+	}
+	return s == ""
+}
+
+// fuzzyMatchCommands returns all commands that have a name or alternative name
+// containing the characters of arg in the same order. Names starting with the
+// first character of arg are preferred; only if there are no such names, the
+// other names are considered.
+func fuzzyMatchCommands(commands []*Command, arg string) []*Command {
+	if arg == "" {
+		return nil
+	}
+	var anchored, others []*Command
+	for _, c := range commands {
+		match := false
+		for _, name := range c.AllNames() {
+			if !isSubsequence(arg, name) {
+				continue
+			}
+			if name[0] == arg[0] {
+				anchored = append(anchored, c)
+				match = false
+				break
+			}
+			match = true
+		}
+		if match {
+			others = append(others, c)
+		}
+	}
+	if len(anchored) > 0 {
+		return anchored
+	}
+	return others
+}
+
+func hasVisibleCommands(commands []*Command) bool {
+	for _, c := range commands {
+		if !c.Hidden {
+			return true
+		}
+	}
+	return false
+}
+
 func maxLen(strings []string) int {
 	n := 0
 	for _, s := range strings {
-		k := utf8.RuneCountInString(s)
+		k := DisplayWidth(s)
 		if k > n {
 			n = k
 		}
@@ -108,11 +430,20 @@ func maxLen(strings []string) int {
 // WriteDoc puts the documentation our on w. the style used is that of man
 // files.
 func (cmd *Command) WriteDoc(w io.Writer) (n int, err error) {
-	const indent = "    "
+	return cmd.WriteDocIndented(w, "")
+}
+
+// WriteDocIndented writes the documentation like WriteDoc but every non-empty
+// line is preceded by baseIndent. It supports the composition of the
+// documentation for multiple commands into a larger document.
+func (cmd *Command) WriteDocIndented(w io.Writer, baseIndent string) (n int, err error) {
+	const docIndent = "    "
+	indent := baseIndent + docIndent
+	cmd.loadSubcommands()
 	var k int
 	i := 0
 	if cmd.Name != "" || cmd.Info != "" {
-		k, err = fmt.Fprintln(w, "NAME")
+		k, err = fmt.Fprintf(w, "%sNAME\n", baseIndent)
 		n += k
 		if err != nil {
 			return n, err
@@ -132,7 +463,11 @@ func (cmd *Command) WriteDoc(w io.Writer) (n int, err error) {
 			return n, err
 		}
 	}
-	if cmd.Usage != "" {
+	usage := cmd.Usage
+	if usage == "" && len(cmd.PositionalArgs) > 0 {
+		usage = cmd.synopsis()
+	}
+	if usage != "" {
 		if i > 0 {
 			k, err = fmt.Fprintln(w)
 			n += k
@@ -141,18 +476,46 @@ func (cmd *Command) WriteDoc(w io.Writer) (n int, err error) {
 			}
 		}
 		i++
-		k, err = fmt.Fprintln(w, "USAGE")
+		k, err = fmt.Fprintf(w, "%sUSAGE\n", baseIndent)
 		n += k
 		if err != nil {
 			return n, err
 		}
-		k, err = fmt.Fprintf(w, "%s%s\n", indent, cmd.Usage)
+		// Blank lines are dropped, so that a multi-line usage
+		// string in a raw string literal doesn't add blank lines.
+		for _, line := range strings.Split(usage, "\n") {
+			line = strings.TrimRight(line, " \t\r")
+			if line == "" {
+				continue
+			}
+			k, err = fmt.Fprintf(w, "%s%s\n", indent, line)
+			n += k
+			if err != nil {
+				return n, err
+			}
+		}
+	}
+	if cmd.Description != "" {
+		if i > 0 {
+			k, err = fmt.Fprintln(w)
+			n += k
+			if err != nil {
+				return n, err
+			}
+		}
+		i++
+		k, err = fmt.Fprintf(w, "%sDESCRIPTION\n", baseIndent)
+		n += k
+		if err != nil {
+			return n, err
+		}
+		k, err = FormatText(w, cmd.Description, 80, indent)
 		n += k
 		if err != nil {
 			return n, err
 		}
 	}
-	if cmd.Description != "" {
+	if len(cmd.PositionalArgs) > 0 {
 		if i > 0 {
 			k, err = fmt.Fprintln(w)
 			n += k
@@ -161,18 +524,18 @@ func (cmd *Command) WriteDoc(w io.Writer) (n int, err error) {
 			}
 		}
 		i++
-		k, err = fmt.Fprintln(w, "DESCRIPTION")
+		k, err = fmt.Fprintf(w, "%sARGUMENTS\n", baseIndent)
 		n += k
 		if err != nil {
 			return n, err
 		}
-		k, err = formatText(w, cmd.Description, 80, indent)
+		k, err = usageArgs(w, cmd.PositionalArgs, indent, docIndent)
 		n += k
 		if err != nil {
 			return n, err
 		}
 	}
-	if len(cmd.Options) > 0 {
+	if options := visibleOptions(cmd.localOptions()); len(options) > 0 {
 		if i > 0 {
 			k, err = fmt.Fprintln(w)
 			n += k
@@ -181,18 +544,18 @@ func (cmd *Command) WriteDoc(w io.Writer) (n int, err error) {
 			}
 		}
 		i++
-		k, err = fmt.Fprintln(w, "OPTIONS")
+		k, err = fmt.Fprintf(w, "%sOPTIONS\n", baseIndent)
 		n += k
 		if err != nil {
 			return n, err
 		}
-		k, err = UsageOptions(w, cmd.Options, indent, indent)
+		k, err = UsageOptions(w, options, indent, docIndent)
 		n += k
 		if err != nil {
 			return n, err
 		}
 	}
-	if len(cmd.Subcommands) > 0 {
+	if options := visibleOptions(cmd.inheritedOptions()); len(options) > 0 {
 		if i > 0 {
 			k, err = fmt.Fprintln(w)
 			n += k
@@ -201,14 +564,34 @@ func (cmd *Command) WriteDoc(w io.Writer) (n int, err error) {
 			}
 		}
 		i++
-		k, err = fmt.Fprintln(w, "SUBCOMMANDS")
+		k, err = fmt.Fprintf(w, "%sGLOBAL OPTIONS\n", baseIndent)
+		n += k
+		if err != nil {
+			return n, err
+		}
+		k, err = UsageOptions(w, options, indent, docIndent)
+		n += k
+		if err != nil {
+			return n, err
+		}
+	}
+	if hasVisibleCommands(cmd.Subcommands) {
+		if i > 0 {
+			k, err = fmt.Fprintln(w)
+			n += k
+			if err != nil {
+				return n, err
+			}
+		}
+		i++
+		k, err = fmt.Fprintf(w, "%sSUBCOMMANDS\n", baseIndent)
 		n += k
 		if err != nil {
 			return n, err
 		}
 		names := make([]string, 0, len(cmd.Subcommands))
 		for _, c := range cmd.Subcommands {
-			if c.Name != "" {
+			if c.Name != "" && !c.Hidden {
 				names = append(names, c.Name)
 			}
 		}
@@ -222,8 +605,8 @@ func (cmd *Command) WriteDoc(w io.Writer) (n int, err error) {
 				panic(fmt.Errorf("can't find %q", name))
 			}
 			if subcmd.Info != "" {
-				k, err = fmt.Fprintf(w, "%s%-*s- %s\n",
-					indent, maxNameLen+1, name, subcmd.Info)
+				k, err = writeInfo(w, indent, name, maxNameLen,
+					subcmd.Info)
 			} else {
 				k, err = fmt.Fprintf(w, "%s%s\n", indent, name)
 			}
@@ -243,6 +626,25 @@ func (cmd *Command) WriteDoc(w io.Writer) (n int, err error) {
 	return n, nil
 }
 
+// writeInfo writes the line "name - info" for the SUBCOMMANDS section. The
+// name is padded to the display width nameLen and info is wrapped with a
+// hanging indent, so that continuation lines are aligned with the start of
+// info.
+func writeInfo(w io.Writer, indent, name string, nameLen int, info string) (n int, err error) {
+	hang := strings.Repeat(" ", nameLen+3)
+	width := 80 - len(hang)
+	if width < 20 {
+		width = 20
+	}
+	var sb strings.Builder
+	if _, err = FormatText(&sb, info, width, indent+hang); err != nil {
+		return 0, err
+	}
+	text := strings.TrimPrefix(sb.String(), indent+hang)
+	pad := strings.Repeat(" ", nameLen+1-DisplayWidth(name))
+	return fmt.Fprintf(w, "%s%s%s- %s", indent, name, pad, text)
+}
+
 // CommandError might be generated during Command parsing.
 type CommandError struct {
 	Name    string
@@ -253,6 +655,15 @@ type CommandError struct {
 // Unwrap returns the wrapped error.
 func (err *CommandError) Unwrap() error { return err.Wrapped }
 
+// Is checks whether the error is actually one of the errors provided. Command
+// errors match if they have the same name.
+func (err *CommandError) Is(e error) bool {
+	if ce, ok := e.(*CommandError); ok {
+		return err.Name == ce.Name
+	}
+	return errors.Is(err.Wrapped, e)
+}
+
 // Error prints the error message and appends the error string of the wrapped
 // error.
 func (err *CommandError) Error() string {
@@ -281,67 +692,611 @@ func unrecognizedCommand(arg string) *CommandError {
 	}
 }
 
+// noOptionsError returns the error for an option given to the last of the
+// commands, which has the NoOptions field set.
+func noOptionsError(commands []*Command, arg string, n int) *OptionError {
+	names := make([]string, len(commands))
+	for i, c := range commands {
+		names[i] = c.Name
+	}
+	name := strings.TrimLeft(arg, "-")
+	if i := strings.IndexByte(name, '='); i >= 0 {
+		name = name[:i]
+	}
+	return &OptionError{
+		Option: name,
+		Msg: fmt.Sprintf("command %s accepts no options",
+			strings.Join(names, " ")),
+		ArgIndex: n,
+	}
+}
+
 // Parse parses the argument list and determines the sequence of subcommands.
 // The root command itself is not parsed but its flags. Out is used for error
 // messages during parsing. The return value n provides the number of commands
 // parsed.
+//
+// The options of a command are its own options and the persistent options of
+// the command and all the commands preceding it. Options are routed by their
+// position: the options following the name of a command up to the next
+// subcommand belong to that command. So in "foo -a sub -b" the option -a must
+// be an option of foo and -b an option of sub or a persistent option of foo.
+// If an option of a preceding command follows a subcommand, the error message
+// names the command owning the option. If an immediate option is given,
+// Parse returns ErrImmediate, possibly wrapped in a CommandError.
+//
+// Options that haven't been given are set from their environment variables
+// before the required options are checked. See ApplyEnv.
 func Parse(root *Command, args []string) (commands []*Command, n int, err error) {
+	commands, _, n, err = parse(root, args, false)
+	if err != nil {
+		return commands, n, err
+	}
+	if err = applyDefaults(commands); err != nil {
+		return commands, n, err
+	}
+	return commands, n, checkRequiredOptions(commands)
+}
+
+// applyDefaults sets the options of the commands that haven't been given from
+// their default templates and from their environment variables.
+func applyDefaults(commands []*Command) error {
+	var options []*Option
+	for _, cmd := range commands {
+		options = append(options, cmd.localOptions()...)
+	}
+	if err := applyDefaultTemplates(options); err != nil {
+		return err
+	}
+	return ApplyEnv(options)
+}
+
+// helpRequested reports whether the last command is the help command or a
+// help option has been given.
+func helpRequested(commands []*Command) bool {
+	if commands[len(commands)-1].help {
+		return true
+	}
+	for _, cmd := range commands {
+		if helpSeen(cmd.localOptions()) {
+			return true
+		}
+	}
+	return false
+}
+
+// requiredScope returns the options of commands[i] whose requirement is
+// checked: all options of the last command and the persistent options of the
+// others.
+func requiredScope(commands []*Command, i int) []*Option {
+	if i == len(commands)-1 {
+		return commands[i].localOptions()
+	}
+	return commands[i].PersistentOptions
+}
+
+// promptRequired prompts for the missing required options if the command
+// selected has PromptRequired set and the standard input is a terminal.
+func promptRequired(commands []*Command) error {
+	cmd := commands[len(commands)-1]
+	if !cmd.PromptRequired || helpRequested(commands) ||
+		!IsTerminal(os.Stdin.Fd()) {
+		return nil
+	}
+	var options []*Option
+	for i := range commands {
+		options = append(options, requiredScope(commands, i)...)
+	}
+	return PromptMissing(options, os.Stdin, os.Stderr)
+}
+
+// checkRequiredOptions checks the required options of the last command and
+// the persistent options of all commands. Errors for options of subcommands
+// are wrapped in a CommandError. The check is skipped for the help command and
+// if a help option has been given.
+func checkRequiredOptions(commands []*Command) error {
+	if helpRequested(commands) {
+		return nil
+	}
+	var errList errorList
+	for i, cmd := range commands {
+		err := checkRequired(requiredScope(commands, i))
+		if err != nil && i > 0 {
+			err = &CommandError{Name: cmd.Name, Wrapped: err}
+		}
+		if err != nil {
+			errList = append(errList, err)
+		}
+	}
+	return errList.Flatten()
+}
+
+// ResolvePartial determines the deepest command selected by a possibly
+// incomplete argument list without executing it and without reporting errors.
+// It returns the command and the arguments that follow the command and its
+// options. If an option can't be parsed, rest starts with the argument
+// causing the error. The values of the options are not changed. Like Parse
+// the function doesn't expand aliases. It is intended for prompt hints and
+// completion.
+func ResolvePartial(root *Command, args []string) (cmd *Command, rest []string) {
+	cmd = root
+	cmd.parent = nil
+	var inherited []*Option
+	n := 0
+	for {
+		options := append(cmd.localOptions(), inherited...)
+		inherited = append(inherited, cmd.PersistentOptions...)
+		if len(options) > 0 {
+			p := &optionParser{
+				options:          dryRunOptions(options),
+				stopOnFirstError: true,
+				offset:           n,
+				disableDashDash:  cmd.DisableDashDash,
+			}
+			k, err := p.parse(args[n:])
+			if err != nil {
+				var oe *OptionError
+				if errors.As(err, &oe) {
+					return cmd, args[oe.ArgIndex:]
+				}
+				return cmd, args[n:]
+			}
+			n += k
+		}
+		if n >= len(args) {
+			return cmd, nil
+		}
+		found, err := cmd.matchSubcommand(args[n])
+		if err != nil || found == nil {
+			return cmd, args[n:]
+		}
+		n++
+		found.parent = cmd
+		cmd = found
+	}
+}
+
+// dryRunOptions returns copies of the options that don't set any values,
+// don't warn about deprecation and don't stop the parsing.
+func dryRunOptions(options []*Option) []*Option {
+	copies := make([]*Option, len(options))
+	for i, o := range options {
+		c := *o
+		c.Deprecated = ""
+		c.Immediate = false
+		c.SetValue = func(name, param string, noParam bool) error {
+			return nil
+		}
+		copies[i] = &c
+	}
+	return copies
+}
+
+// expandAlias replaces the alias at position n of args by its expansion. It
+// returns false if arg[n] is not an alias of the command. Names of
+// subcommands take precedence over aliases.
+func (cmd *Command) expandAlias(args []string, n int) (expanded []string, ok bool, err error) {
+	arg := args[n]
+	alias, ok := cmd.Aliases[arg]
+	if !ok {
+		return args, false, nil
+	}
+	cmd.loadSubcommands()
+	if _, found := findCommand(cmd.Subcommands, arg); found {
+		return args, false, nil
+	}
+	a, err := SplitArgs(alias)
+	if err != nil {
+		return args, false, &CommandError{
+			Name:    cmd.Name,
+			Message: fmt.Sprintf("can't expand alias %s", arg),
+			Wrapped: err,
+		}
+	}
+	expanded = make([]string, 0, len(args)-1+len(a))
+	expanded = append(expanded, args[:n]...)
+	expanded = append(expanded, a...)
+	expanded = append(expanded, args[n+1:]...)
+	return expanded, true, nil
+}
+
+// parse implements Parse. It returns the argument list, which differs from
+// the args provided if aliases have been expanded.
+func parse(root *Command, args []string, expandAliases bool) (commands []*Command, rargs []string, n int, err error) {
 	commands = make([]*Command, 0, 4)
 	cmd := root
+	cmd.parent = nil
+	var inherited []*Option
 	for {
 		commands = append(commands, cmd)
-		if len(cmd.Options) > 0 {
-			k, err := ParseOptions(cmd.Options, args[n:])
-			n += k
-			if err != nil {
-				if cmd != root {
-					err = &CommandError{
-						Name:    cmd.Name,
-						Message: "",
-						Wrapped: err}
+		if root.Debug != nil {
+			fmt.Fprintf(root.Debug, "cli: command %s\n", cmd.Name)
+		}
+		local := cmd.localOptions()
+		clearSeenOptions(local)
+		options := append(local, inherited...)
+		inherited = append(inherited, cmd.PersistentOptions...)
+		// An alias expansion is not expanded again, but it may start
+		// with options.
+		expanded := !expandAliases
+		// dashDash records that the option parser consumed "--".
+		dashDash := false
+		for {
+			if len(options) > 0 {
+				p := &optionParser{
+					options:          options,
+					debug:            root.Debug,
+					stopOnFirstError: root.StopOnFirstError,
+					offset:           n,
+					disableDashDash:  cmd.DisableDashDash,
+					lenientBooleans:  cmd.LenientBooleans,
+					diagnostics:      root.Diagnostics,
+					command:          cmd.Name,
+				}
+				k, err := p.parse(args[n:])
+				n += k
+				dashDash = dashDash || p.dashDash
+				if err != nil {
+					annotateOwner(cmd, options, args, err)
+					if cmd != root {
+						err = &CommandError{
+							Name:    cmd.Name,
+							Message: "",
+							Wrapped: err}
+					}
+					return commands, args, n, err
 				}
-				return commands, n, err
 			}
+			if n >= len(args) || expanded {
+				break
+			}
+			var ok bool
+			args, ok, err = cmd.expandAlias(args, n)
+			if err != nil {
+				return commands, args, n, err
+			}
+			if !ok {
+				break
+			}
+			expanded = true
+		}
+		if n < len(args) && cmd.NoOptions && !dashDash &&
+			isOptionArg(args[n]) && args[n] != "--" {
+			return commands, args, n, noOptionsError(commands, args[n], n)
 		}
 		if n < len(args) {
-			arg := args[n]
-			var found *Command
-			for _, c := range cmd.Subcommands {
-				if strings.HasPrefix(c.Name, arg) {
-					if found != nil {
-						err = unrecognizedCommand(arg)
-						return commands, n, err
-					}
-					found = c
-				}
+			found, err := cmd.matchSubcommand(args[n])
+			if err != nil {
+				return commands, args, n, err
 			}
 			if found == nil {
-				return commands, n, nil
+				if cmd.StrictSubcommands {
+					err = unrecognizedCommand(args[n])
+				}
+				return commands, args, n, err
 			}
 			n++
+			found.parent = cmd
 			cmd = found
 			continue
 		}
-		return commands, n, nil
+		return commands, args, n, nil
 	}
 }
 
-// Run parses the arguments and executes the exec command for the command
-// identified. The call may return an error.
-func Run(root *Command, args []string) error {
-	commands, n, err := Parse(root, args)
-	if err != nil {
-		return err
+// annotateOwner extends the messages of unrecognized option errors if the
+// option belongs to a command preceding cmd. The options argument contains the
+// options accepted by cmd.
+func annotateOwner(cmd *Command, options []*Option, args []string, err error) {
+	errs, ok := err.(errorList)
+	if !ok {
+		errs = errorList{err}
+	}
+	for _, e := range errs {
+		oe, ok := e.(*OptionError)
+		if !ok || oe.Option != "unrecognized" || oe.ArgIndex >= len(args) {
+			continue
+		}
+		if owner := optionOwner(cmd, options, args[oe.ArgIndex]); owner != nil {
+			oe.Msg += fmt.Sprintf(
+				"; it is an option of command %s and must precede %s",
+				owner.Name, cmd.Name)
+		}
+	}
+}
+
+// optionOwner returns the command preceding cmd that has an option in arg
+// that is not accepted by cmd. It returns nil if there is no such command.
+func optionOwner(cmd *Command, options []*Option, arg string) *Command {
+	known := func(opts []*Option, f func(o *Option) bool) bool {
+		for _, o := range opts {
+			if f(o) {
+				return true
+			}
+		}
+		return false
+	}
+	var match func(o *Option) bool
+	if strings.HasPrefix(arg, "--") {
+		name := arg[2:]
+		if i := strings.IndexByte(name, '='); i >= 0 {
+			name = name[:i]
+		}
+		match = func(o *Option) bool { return o.hasName(name) }
+	} else {
+		var unknown []string
+		for _, r := range strings.TrimPrefix(arg, "-") {
+			short := string(r)
+			f := func(o *Option) bool { return o.hasShortString(short) }
+			if !known(options, f) {
+				unknown = append(unknown, short)
+			}
+		}
+		if len(unknown) == 0 {
+			return nil
+		}
+		match = func(o *Option) bool { return o.hasShortString(unknown[0]) }
+	}
+	for c := cmd.parent; c != nil; c = c.parent {
+		if known(c.Options, match) {
+			return c
+		}
+	}
+	return nil
+}
+
+// checkEnv verifies that all environment variables in the RequiredEnv fields
+// of the commands are set. The commands are the sequence from the root to the
+// command selected.
+func checkEnv(commands []*Command) error {
+	var missing []string
+	seen := make(map[string]bool)
+	for _, cmd := range commands {
+		for _, name := range cmd.RequiredEnv {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			if _, ok := os.LookupEnv(name); !ok {
+				missing = append(missing, name)
+			}
+		}
+	}
+	if len(missing) == 0 {
+		return nil
 	}
 	cmd := commands[len(commands)-1]
-	if cmd.Exec == nil {
-		err := &CommandError{
-			Name:    cmd.Name,
-			Message: "couldn't find executable subcommand",
+	return &CommandError{
+		Name: cmd.Name,
+		Message: fmt.Sprintf("missing environment variables %s",
+			strings.Join(missing, ", ")),
+	}
+}
+
+// Conventional exit codes returned by RunCode.
+const (
+	ExitOK    = 0
+	ExitError = 1
+	ExitUsage = 2
+)
+
+// CodeError reports a non-zero exit code returned by the ExecCode function of a
+// command.
+type CodeError struct {
+	Code int
+}
+
+func (err *CodeError) Error() string {
+	return fmt.Sprintf("exit code %d", err.Code)
+}
+
+// ExitCode returns the exit code.
+func (err *CodeError) ExitCode() int { return err.Code }
+
+// noExecError reports that the command selected has no Exec function, which
+// usually means that a subcommand is missing.
+func noExecError(cmd *Command) error {
+	return &CommandError{
+		Name:    cmd.Name,
+		Message: "couldn't find executable subcommand",
+	}
+}
+
+// usageError marks an error returned by Exec as usage error, which results in
+// the exit code ExitUsage.
+type usageError struct {
+	error
+}
+
+func (err usageError) Unwrap() error { return err.error }
+
+// ExitCode returns ExitUsage.
+func (err usageError) ExitCode() int { return ExitUsage }
+
+// ErrHelpRequested is returned by Run after the help command or the help
+// option printed the help if HelpReturnsError is set for the root command.
+var ErrHelpRequested = errors.New("cli: help requested")
+
+// run implements RunContext and RunCode.
+func run(ctx context.Context, root *Command, args []string) (code int, err error) {
+	if root.Rewrite != nil {
+		if args, err = root.Rewrite(args); err != nil {
+			return ExitUsage, err
 		}
-		return err
+	}
+	commands, args, n, err := parse(root, args, true)
+	if err != nil {
+		if errors.Is(err, ErrImmediate) {
+			return ExitOK, nil
+		}
+		return ExitUsage, err
+	}
+	if err = applyDefaults(commands); err != nil {
+		return ExitUsage, err
+	}
+	if err = loadDefaultConfig(commands); err != nil {
+		return ExitError, err
+	}
+	if err = promptRequired(commands); err != nil {
+		return ExitUsage, err
+	}
+	if err = checkRequiredOptions(commands); err != nil {
+		return ExitUsage, err
+	}
+	cmd := commands[len(commands)-1]
+	noExec := !cmd.hasExec()
+	if (noExec || cmd.helpOnly) && root.ExternalPrefix != "" &&
+		cmd == root && n < len(args) {
+		return runExternal(root, args[n:])
+	}
+	if noExec {
+		return ExitUsage, noExecError(cmd)
 	}
 	args = args[n:]
-	err = cmd.Exec(args)
+	// The help option is evaluated by Exec, so the checks must not fail
+	// before.
+	if !helpRequested(commands) {
+		if err = checkEnv(commands); err != nil {
+			return ExitError, err
+		}
+		if err = checkArgs(cmd, args); err != nil {
+			return ExitUsage, err
+		}
+	}
+	if cmd.ExecCode != nil {
+		code = cmd.ExecCode(args)
+		if code != ExitOK {
+			return code, &CodeError{Code: code}
+		}
+		return ExitOK, nil
+	}
+	if cmd.ExecContext != nil {
+		err = cmd.ExecContext(withDryRun(ctx, root), args)
+	} else {
+		err = cmd.Exec(args)
+	}
+	if err != nil {
+		if errors.Is(err, ErrHelpRequested) {
+			return ExitOK, err
+		}
+		var ec interface{ ExitCode() int }
+		if errors.As(err, &ec) {
+			return ec.ExitCode(), err
+		}
+		return ExitError, err
+	}
+	return ExitOK, nil
+}
+
+// runExternal executes the external program for the subcommand args[0] with
+// the remaining arguments. The standard input and outputs of the process are
+// passed to the program. A non-zero exit code of the program is reported as
+// *CodeError.
+func runExternal(root *Command, args []string) (code int, err error) {
+	path, err := exec.LookPath(root.ExternalPrefix + args[0])
+	if err != nil {
+		return ExitUsage, unrecognizedCommand(args[0])
+	}
+	c := exec.Command(path, args[1:]...)
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	if err = c.Run(); err != nil {
+		var ee *exec.ExitError
+		if errors.As(err, &ee) && ee.ExitCode() > 0 {
+			// The program has reported its error itself.
+			return ee.ExitCode(), &CodeError{Code: ee.ExitCode()}
+		}
+		return ExitError, &CommandError{
+			Name:    args[0],
+			Message: fmt.Sprintf("can't execute %s", path),
+			Wrapped: err,
+		}
+	}
+	return ExitOK, nil
+}
+
+// Run parses the arguments and executes the exec command for the command
+// identified. The call may return an error. In contrast to Parse, Run expands
+// the aliases of commands. A non-zero exit code returned by ExecCode is
+// reported as *CodeError. Run returns nil without executing a command if an
+// immediate option has been given.
+func Run(root *Command, args []string) error {
+	return RunContext(context.Background(), root, args)
+}
+
+// RunContext works like Run but passes ctx to the ExecContext function of the
+// command. Commands providing only Exec are executed without the context.
+func RunContext(ctx context.Context, root *Command, args []string) error {
+	_, err := run(ctx, root, args)
 	return err
 }
+
+// RunCode works like Run but returns an exit code for the process in addition
+// to the error. Parse errors result in ExitUsage, errors returned by Exec in
+// ExitError unless they provide an ExitCode method. The exit code of ExecCode
+// is returned without an error. ErrHelpRequested results in ExitOK without
+// error.
+func RunCode(root *Command, args []string) (code int, err error) {
+	code, err = run(context.Background(), root, args)
+	if errors.Is(err, ErrHelpRequested) {
+		return ExitOK, nil
+	}
+	var ce *CodeError
+	if errors.As(err, &ce) {
+		return ce.Code, nil
+	}
+	return code, err
+}
+
+// RunMain runs the command like RunCode and returns the exit code. Errors are
+// written to errOut prefixed by the name of the root command. For usage errors
+// the usage of the command and, if the root command has a help subcommand, a
+// hint how to get help are written as well. Diagnostics collected in the
+// Diagnostics field of the root command precede the error message. A typical
+// main function calls
+//
+//	os.Exit(cli.RunMain(root, os.Args[1:], os.Stderr))
+func RunMain(root *Command, args []string, errOut io.Writer) int {
+	code, err := RunCode(root, args)
+	if root.Diagnostics != nil {
+		root.Diagnostics.WriteTo(errOut)
+	}
+	if err == nil {
+		return code
+	}
+	// Errors of the root command are already prefixed by its name.
+	msg := err.Error()
+	if !strings.HasPrefix(msg, root.Name+": ") {
+		msg = root.Name + ": " + msg
+	}
+	fmt.Fprintln(errOut, msg)
+	if code == ExitUsage {
+		cmd, _ := ResolvePartial(root, args)
+		writeUsageHint(errOut, root, cmd)
+	}
+	return code
+}
+
+// writeUsageHint writes the usage of cmd and a hint to the help command to w.
+// The synopsis generated for a command without Usage field starts with the
+// names of the commands from the root.
+func writeUsageHint(w io.Writer, root, cmd *Command) {
+	var path []string
+	for c := cmd; c != nil && c != root; c = c.parent {
+		path = append([]string{c.Name}, path...)
+	}
+	usage := cmd.Usage
+	if usage == "" {
+		usage = strings.Join(append([]string{root.Name}, path...), " ") +
+			strings.TrimPrefix(cmd.synopsis(), cmd.Name)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(usage), "\n") {
+		fmt.Fprintf(w, "usage: %s\n", strings.TrimSpace(line))
+	}
+	if _, ok := findCommand(root.Subcommands, "help"); !ok {
+		return
+	}
+	help := strings.Join(append([]string{root.Name, "help"}, path...), " ")
+	fmt.Fprintf(w, "Run '%s' for more information.\n", help)
+}
@@ -5,9 +5,16 @@
 package cli_test
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/ulikunitz/cli"
 )
@@ -77,3 +84,1807 @@ func TestParse(t *testing.T) {
 	doc := sb.String()
 	t.Logf("doc:\n%s", doc)
 }
+
+func TestWriteDocPositionalArgs(t *testing.T) {
+	cmd := &cli.Command{
+		Name: "copy",
+		Info: "copies files",
+		PositionalArgs: []cli.ArgSpec{
+			{Name: "src", Description: "source file"},
+			{Name: "dst", Description: "destination files",
+				Optional: true, Variadic: true},
+		},
+	}
+
+	var sb strings.Builder
+	if _, err := cmd.WriteDoc(&sb); err != nil {
+		t.Fatalf("cmd.WriteDoc error %s", err)
+	}
+	doc := sb.String()
+	t.Logf("doc:\n%s", doc)
+
+	for _, s := range []string{
+		"ARGUMENTS",
+		"copy <src> [<dst>...]",
+		"    <src>\n        source file\n",
+	} {
+		if !strings.Contains(doc, s) {
+			t.Errorf("doc doesn't contain %q", s)
+		}
+	}
+}
+
+func TestRunPositionalArgs(t *testing.T) {
+	var (
+		src  string
+		dsts []string
+	)
+	cmd := &cli.Command{
+		Name: "copy",
+		PositionalArgs: []cli.ArgSpec{
+			{Name: "src", SetValue: func(arg string) error {
+				src = arg
+				return nil
+			}},
+			{Name: "dst", Optional: true, Variadic: true,
+				SetValue: func(arg string) error {
+					if arg == "" {
+						return errors.New("empty")
+					}
+					dsts = append(dsts, arg)
+					return nil
+				}},
+		},
+		Exec: func(args []string) error { return nil },
+	}
+
+	tests := []struct {
+		args []string
+		msg  string
+		src  string
+		dsts int
+	}{
+		{args: []string{}, msg: "argument <src> is required"},
+		{args: []string{"a"}, src: "a"},
+		{args: []string{"a", "b", "c"}, src: "a", dsts: 2},
+		{args: []string{"a", ""}, msg: "invalid value"},
+	}
+	for _, tc := range tests {
+		src, dsts = "", nil
+		err := cli.Run(cmd, tc.args)
+		if tc.msg != "" {
+			if err == nil {
+				t.Fatalf("Run(cmd, %q) returned no error", tc.args)
+			}
+			if !strings.Contains(err.Error(), tc.msg) {
+				t.Fatalf("Run(cmd, %q) error %q; want %q",
+					tc.args, err, tc.msg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Run(cmd, %q) error %s", tc.args, err)
+		}
+		if src != tc.src {
+			t.Errorf("Run(cmd, %q): src %q; want %q",
+				tc.args, src, tc.src)
+		}
+		if len(dsts) != tc.dsts {
+			t.Errorf("Run(cmd, %q): got %d dsts; want %d",
+				tc.args, len(dsts), tc.dsts)
+		}
+	}
+}
+
+func TestRunPositionalArgsRequiredAfterOptional(t *testing.T) {
+	var dst string
+	cmd := &cli.Command{
+		Name: "copy",
+		PositionalArgs: []cli.ArgSpec{
+			{Name: "src", Optional: true},
+			{Name: "dst", SetValue: func(arg string) error {
+				dst = arg
+				return nil
+			}},
+		},
+		Exec: func(args []string) error { return nil },
+	}
+	err := cli.Run(cmd, nil)
+	if err == nil || !strings.Contains(err.Error(),
+		"argument <dst> is required") {
+		t.Fatalf("Run(cmd, nil) error %v; want missing <dst>", err)
+	}
+	if err = cli.Run(cmd, []string{"a", "b"}); err != nil {
+		t.Fatalf("Run(cmd, a b) error %s", err)
+	}
+	if dst != "b" {
+		t.Fatalf("dst is %q; want %q", dst, "b")
+	}
+}
+
+func captureStdout(t *testing.T, f func() error) (string, error) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("os.Pipe error %s", err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+	ch := make(chan string)
+	go func() {
+		d, _ := io.ReadAll(r)
+		ch <- string(d)
+	}()
+	err = f()
+	w.Close()
+	return <-ch, err
+}
+
+func TestHelpFormat(t *testing.T) {
+	root := &cli.Command{
+		Name: "foo",
+		Subcommands: []*cli.Command{
+			{Name: "db", Info: "database commands"},
+		},
+	}
+	cli.AddHelpCommand(root)
+
+	for _, args := range [][]string{
+		{"help", "db", "--format", "text"},
+		{"help", "--format=text", "db"},
+	} {
+		out, err := captureStdout(t, func() error {
+			return cli.Run(root, args)
+		})
+		if err != nil {
+			t.Fatalf("Run(root, %q) error %s", args, err)
+		}
+		if !strings.Contains(out, "db - database commands") {
+			t.Errorf("Run(root, %q) output %q", args, out)
+		}
+	}
+
+	args := []string{"help", "db", "--format", "markdown"}
+	out, err := captureStdout(t, func() error {
+		return cli.Run(root, args)
+	})
+	if err != nil {
+		t.Fatalf("Run(root, %q) error %s", args, err)
+	}
+	if !strings.Contains(out, "## NAME\n\ndb - database commands\n") {
+		t.Errorf("Run(root, %q) output %q", args, out)
+	}
+
+	args = []string{"help", "db", "--format", "foo"}
+	if err := cli.Run(root, args); err == nil {
+		t.Fatalf("Run(root, %q) returned no error", args)
+	}
+
+	args = []string{"help", "db", "--format", "txt"}
+	err = cli.Run(root, args)
+	var oe *cli.OptionError
+	if !errors.As(err, &oe) || oe.Suggestion != "text" {
+		t.Fatalf("Run(root, %q) error %v; want suggestion %q",
+			args, err, "text")
+	}
+	if !strings.Contains(err.Error(), `did you mean "text"?`) {
+		t.Fatalf("error message %q doesn't contain suggestion", err)
+	}
+}
+
+func TestHelpAlias(t *testing.T) {
+	root := &cli.Command{
+		Name: "foo",
+		Subcommands: []*cli.Command{
+			{Name: "list", Names: []string{"ls"},
+				Info: "lists all entries"},
+			{Name: "lock", Info: "locks the database"},
+			{Name: "lsof", Info: "lists open files"},
+		},
+	}
+	cli.AddHelpCommand(root)
+
+	for _, topic := range []string{"list", "ls", "li"} {
+		args := []string{"help", topic}
+		out, err := captureStdout(t, func() error {
+			return cli.Run(root, args)
+		})
+		if err != nil {
+			t.Fatalf("Run(root, %q) error %s", args, err)
+		}
+		if !strings.Contains(out, "list - lists all entries") {
+			t.Errorf("Run(root, %q) output %q", args, out)
+		}
+	}
+
+	args := []string{"help", "l"}
+	if err := cli.Run(root, args); err == nil {
+		t.Fatalf("Run(root, %q) returned no error", args)
+	}
+}
+
+func TestWriteDocIndented(t *testing.T) {
+	var f bool
+	cmd := &cli.Command{
+		Name:        "foo",
+		Info:        "test program",
+		Description: "The program foo does nothing.",
+		Options: []*cli.Option{
+			cli.BoolOption(&f, "flag", 'f', "a boolean option"),
+		},
+	}
+
+	var sb strings.Builder
+	if _, err := cmd.WriteDocIndented(&sb, "  "); err != nil {
+		t.Fatalf("cmd.WriteDocIndented error %s", err)
+	}
+	doc := sb.String()
+	t.Logf("doc:\n%s", doc)
+
+	for _, line := range strings.Split(doc, "\n") {
+		if line != "" && !strings.HasPrefix(line, "  ") {
+			t.Errorf("line %q not indented", line)
+		}
+	}
+	for _, s := range []string{
+		"  NAME\n      foo - test program\n",
+		"          a boolean option\n",
+	} {
+		if !strings.Contains(doc, s) {
+			t.Errorf("doc doesn't contain %q", s)
+		}
+	}
+}
+
+func TestParseDebug(t *testing.T) {
+	var (
+		dir   string
+		force bool
+	)
+	var sb strings.Builder
+	root := &cli.Command{
+		Name: "foo",
+		Options: []*cli.Option{
+			cli.StringOption(&dir, "dir", 'd', "directory"),
+		},
+		Subcommands: []*cli.Command{
+			{
+				Name: "delete",
+				Options: []*cli.Option{
+					cli.BoolOption(&force, "force", 'f',
+						"force deletion"),
+				},
+			},
+		},
+		Debug: &sb,
+	}
+
+	_, _, err := cli.Parse(root, []string{"--dir", "x", "del", "-f"})
+	if err != nil {
+		t.Fatalf("Parse error %s", err)
+	}
+	trace := sb.String()
+	t.Logf("trace:\n%s", trace)
+	for _, s := range []string{
+		"command foo\n",
+		"option dir parameter \"x\"\n",
+		"command delete\n",
+		"option f\n",
+	} {
+		if !strings.Contains(trace, s) {
+			t.Errorf("trace doesn't contain %q", s)
+		}
+	}
+}
+
+func TestStrictSubcommands(t *testing.T) {
+	root := &cli.Command{
+		Name: "foo",
+		Subcommands: []*cli.Command{
+			{Name: "start", Exec: func(args []string) error {
+				return nil
+			}},
+		},
+		Exec: func(args []string) error { return nil },
+	}
+
+	args := []string{"stop"}
+	if err := cli.Run(root, args); err != nil {
+		t.Fatalf("Run(root, %q) error %s", args, err)
+	}
+
+	root.StrictSubcommands = true
+	err := cli.Run(root, args)
+	if err == nil {
+		t.Fatalf("Run(root, %q) returned no error", args)
+	}
+	t.Logf("Run(root, %q) error %s", args, err)
+
+	args = []string{"st"}
+	if err := cli.Run(root, args); err != nil {
+		t.Fatalf("Run(root, %q) error %s", args, err)
+	}
+}
+
+func TestNoOptions(t *testing.T) {
+	var got []string
+	leaf := &cli.Command{
+		Name: "leaf",
+		Exec: func(args []string) error {
+			got = args
+			return nil
+		},
+	}
+	root := &cli.Command{
+		Name:        "foo",
+		Subcommands: []*cli.Command{leaf},
+	}
+
+	args := []string{"leaf", "--flag"}
+	if err := cli.Run(root, args); err != nil {
+		t.Fatalf("Run(root, %q) error %s", args, err)
+	}
+	if len(got) != 1 || got[0] != "--flag" {
+		t.Fatalf("leaf got args %q; want %q", got, args[1:])
+	}
+
+	leaf.NoOptions = true
+	err := cli.Run(root, args)
+	if err == nil {
+		t.Fatalf("Run(root, %q) returned no error", args)
+	}
+	const want = "command foo leaf accepts no options"
+	if err.Error() != want {
+		t.Fatalf("Run(root, %q) error %q; want %q", args, err, want)
+	}
+	if !errors.Is(err, &cli.OptionError{Option: "flag"}) {
+		t.Fatalf("error %v is not an OptionError for flag", err)
+	}
+
+	args = []string{"leaf", "-", "--", "-x"}
+	if err = cli.Run(root, args); err != nil {
+		t.Fatalf("Run(root, %q) error %s", args, err)
+	}
+	if len(got) != 3 || got[0] != "-" {
+		t.Fatalf("leaf got args %q; want %q", got, args[1:])
+	}
+
+	// With the help option the option parser consumes "--".
+	cli.AddHelpOption(leaf)
+	args = []string{"leaf", "--", "-x"}
+	if err = cli.Run(root, args); err != nil {
+		t.Fatalf("Run(root, %q) error %s", args, err)
+	}
+	if len(got) != 1 || got[0] != "-x" {
+		t.Fatalf("leaf got args %q; want %q", got, args[2:])
+	}
+	args = []string{"leaf", "-x"}
+	if err = cli.Run(root, args); err == nil {
+		t.Fatalf("Run(root, %q) returned no error", args)
+	}
+}
+
+func TestResolveCommand(t *testing.T) {
+	var sb strings.Builder
+	newCmd := func(name string) *cli.Command {
+		return &cli.Command{
+			Name: name,
+			Exec: func(args []string) error {
+				fmt.Fprintf(&sb, "%s\n", name)
+				return nil
+			},
+		}
+	}
+	root := &cli.Command{
+		Name: "foo",
+		Subcommands: []*cli.Command{
+			newCmd("status"), newCmd("start"), newCmd("stop"),
+		},
+	}
+
+	args := []string{"st"}
+	if err := cli.Run(root, args); err == nil {
+		t.Fatalf("Run(root, %q) returned no error", args)
+	}
+
+	root.ResolveCommand = func(candidates []*cli.Command, arg string) (*cli.Command, error) {
+		return candidates[0], nil
+	}
+	if err := cli.Run(root, args); err != nil {
+		t.Fatalf("Run(root, %q) error %s", args, err)
+	}
+	if got := sb.String(); got != "status\n" {
+		t.Fatalf("Run(root, %q) executed %q; want %q",
+			args, got, "status\n")
+	}
+}
+
+func TestPersistentOptions(t *testing.T) {
+	var (
+		verbose bool
+		force   bool
+	)
+	sub := &cli.Command{
+		Name: "delete",
+		Options: []*cli.Option{
+			cli.BoolOption(&force, "force", 'f', "force deletion"),
+		},
+		Exec: func(args []string) error { return nil },
+	}
+	root := &cli.Command{
+		Name: "foo",
+		PersistentOptions: []*cli.Option{
+			cli.BoolOption(&verbose, "verbose", 'v', "verbose output"),
+		},
+		Subcommands: []*cli.Command{sub},
+	}
+
+	for _, args := range [][]string{
+		{"-v", "delete", "-f"},
+		{"delete", "-v", "-f"},
+		{"delete", "-fv"},
+	} {
+		verbose, force = false, false
+		if err := cli.Run(root, args); err != nil {
+			t.Fatalf("Run(root, %q) error %s", args, err)
+		}
+		if !verbose || !force {
+			t.Errorf("Run(root, %q): verbose=%t force=%t",
+				args, verbose, force)
+		}
+	}
+
+	args := []string{"-f", "delete"}
+	if err := cli.Run(root, args); err == nil {
+		t.Fatalf("Run(root, %q) returned no error", args)
+	}
+
+	var sb strings.Builder
+	if _, err := sub.WriteDoc(&sb); err != nil {
+		t.Fatalf("sub.WriteDoc error %s", err)
+	}
+	doc := sb.String()
+	t.Logf("doc:\n%s", doc)
+	if !strings.Contains(doc, "GLOBAL OPTIONS\n    -v, --verbose\n") {
+		t.Errorf("doc doesn't list the global options")
+	}
+}
+
+func TestStopOnFirstError(t *testing.T) {
+	var (
+		n   int
+		str string
+	)
+	root := &cli.Command{
+		Name: "foo",
+		Options: []*cli.Option{
+			cli.IntOption(&n, "num", 'n', "number"),
+			cli.StringOption(&str, "str", 's', "string"),
+		},
+	}
+	args := []string{"--num=x", "--str=foo", "--num=y"}
+
+	_, _, err := cli.Parse(root, args)
+	if err == nil {
+		t.Fatalf("Parse(root, %q) returned no error", args)
+	}
+	if str != "foo" {
+		t.Fatalf("str is %q; want %q", str, "foo")
+	}
+	if k := strings.Count(err.Error(), "\n") + 1; k != 2 {
+		t.Fatalf("Parse(root, %q) returned %d errors; want %d",
+			args, k, 2)
+	}
+
+	str = ""
+	root.StopOnFirstError = true
+	_, _, err = cli.Parse(root, args)
+	if err == nil {
+		t.Fatalf("Parse(root, %q) returned no error", args)
+	}
+	if str != "" {
+		t.Fatalf("str is %q; want %q", str, "")
+	}
+}
+
+func TestHelpOptionPositionalArgs(t *testing.T) {
+	cp := &cli.Command{
+		Name: "cp",
+		Info: "copies files",
+		PositionalArgs: []cli.ArgSpec{
+			{Name: "src", SetValue: func(arg string) error { return nil }},
+			{Name: "dst", SetValue: func(arg string) error { return nil }},
+		},
+		Exec: func(args []string) error { return nil },
+	}
+	root := &cli.Command{Name: "foo", Subcommands: []*cli.Command{cp}}
+	cli.AddHelpOptionToAll(root)
+
+	out, err := captureStdout(t, func() error {
+		return cli.Run(root, []string{"cp", "-h"})
+	})
+	if err != nil {
+		t.Fatalf("Run(cp -h) error %s", err)
+	}
+	if !strings.Contains(out, "copies files") {
+		t.Fatalf("Run(cp -h) printed %q; want help", out)
+	}
+	if err = cli.Run(root, []string{"cp"}); err == nil {
+		t.Fatalf("Run(cp) returned no error")
+	}
+}
+
+func TestRequiredEnv(t *testing.T) {
+	const name = "CLI_TEST_TOKEN"
+	os.Unsetenv(name)
+	cmd := &cli.Command{
+		Name:        "foo",
+		RequiredEnv: []string{name},
+		Exec:        func(args []string) error { return nil },
+	}
+	err := cli.Run(cmd, nil)
+	if err == nil {
+		t.Fatalf("Run returned no error")
+	}
+	if !strings.Contains(err.Error(), name) {
+		t.Fatalf("Run error %q doesn't mention %s", err, name)
+	}
+
+	os.Setenv(name, "secret")
+	defer os.Unsetenv(name)
+	if err = cli.Run(cmd, nil); err != nil {
+		t.Fatalf("Run error %s", err)
+	}
+}
+
+func TestRequiredEnvInherited(t *testing.T) {
+	const name = "CLI_TEST_ROOT_TOKEN"
+	os.Unsetenv(name)
+	exec := func(args []string) error { return nil }
+	root := &cli.Command{
+		Name:        "foo",
+		RequiredEnv: []string{name},
+		Subcommands: []*cli.Command{
+			{Name: "cp", Exec: exec},
+			{Name: "env", Info: "prints the environment",
+				RequiredEnv: []string{name}, Exec: exec},
+		},
+	}
+	cli.AddHelpOptionToAll(root)
+
+	err := cli.Run(root, []string{"cp", "a", "b"})
+	if err == nil {
+		t.Fatalf("Run(cp a b) returned no error")
+	}
+	if !strings.Contains(err.Error(), name) {
+		t.Fatalf("Run(cp a b) error %q doesn't mention %s", err, name)
+	}
+	err = cli.Run(root, []string{"env"})
+	if err == nil || strings.Count(err.Error(), name) != 1 {
+		t.Fatalf("Run(env) error %v; want %s reported once", err, name)
+	}
+
+	out, err := captureStdout(t, func() error {
+		return cli.Run(root, []string{"env", "-h"})
+	})
+	if err != nil {
+		t.Fatalf("Run(env -h) error %s", err)
+	}
+	if !strings.Contains(out, "prints the environment") {
+		t.Fatalf("Run(env -h) printed %q; want help", out)
+	}
+
+	os.Setenv(name, "secret")
+	defer os.Unsetenv(name)
+	if err = cli.Run(root, []string{"cp", "a", "b"}); err != nil {
+		t.Fatalf("Run(cp a b) error %s", err)
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	var got []string
+	root := &cli.Command{
+		Name: "foo",
+		Subcommands: []*cli.Command{
+			{Name: "checkout", Exec: func(args []string) error {
+				got = args
+				return nil
+			}},
+		},
+		Rewrite: func(args []string) ([]string, error) {
+			if len(args) > 0 && args[0] == "co" {
+				args = append([]string{"checkout", "-q"},
+					args[1:]...)
+			}
+			return args, nil
+		},
+	}
+	if err := cli.Run(root, []string{"co", "main"}); err != nil {
+		t.Fatalf("Run error %s", err)
+	}
+	if len(got) != 2 || got[0] != "-q" || got[1] != "main" {
+		t.Fatalf("checkout got args %q; want %q", got,
+			[]string{"-q", "main"})
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		s    string
+		args []string
+		err  bool
+	}{
+		{s: "", args: nil},
+		{s: "  checkout  --quiet ", args: []string{"checkout", "--quiet"}},
+		{s: `commit -m 'a message'`,
+			args: []string{"commit", "-m", "a message"}},
+		{s: `say "a \"b\" \c"`, args: []string{"say", `a "b" \c`}},
+		{s: `a\ b ''`, args: []string{"a b", ""}},
+		{s: `'foo`, err: true},
+		{s: `foo\`, err: true},
+	}
+	for _, tc := range tests {
+		args, err := cli.SplitArgs(tc.s)
+		if tc.err {
+			if err == nil {
+				t.Errorf("SplitArgs(%q) returned no error", tc.s)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("SplitArgs(%q) error %s", tc.s, err)
+		}
+		if fmt.Sprintf("%q", args) != fmt.Sprintf("%q", tc.args) {
+			t.Errorf("SplitArgs(%q) returned %q; want %q",
+				tc.s, args, tc.args)
+		}
+	}
+}
+
+func TestAliases(t *testing.T) {
+	var (
+		quiet bool
+		got   string
+	)
+	root := &cli.Command{
+		Name: "foo",
+		Subcommands: []*cli.Command{
+			{
+				Name: "checkout",
+				Options: []*cli.Option{
+					cli.BoolOption(&quiet, "quiet", 'q',
+						"no output"),
+				},
+				Exec: func(args []string) error {
+					got = fmt.Sprintf("checkout %t %q",
+						quiet, args)
+					return nil
+				},
+			},
+			{
+				Name: "commit",
+				Exec: func(args []string) error {
+					got = fmt.Sprintf("commit %q", args)
+					return nil
+				},
+			},
+		},
+		Aliases: map[string]string{
+			"co":     "checkout --quiet",
+			"commit": "checkout",
+		},
+	}
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"co", "main"}, `checkout true ["main"]`},
+		{[]string{"commit", "x"}, `commit ["x"]`},
+		{[]string{"check", "main"}, `checkout false ["main"]`},
+	}
+	for _, tc := range tests {
+		quiet = false
+		if err := cli.Run(root, tc.args); err != nil {
+			t.Fatalf("Run(root, %q) error %s", tc.args, err)
+		}
+		if got != tc.want {
+			t.Errorf("Run(root, %q) executed %s; want %s",
+				tc.args, got, tc.want)
+		}
+	}
+}
+
+func TestRunCode(t *testing.T) {
+	root := &cli.Command{
+		Name: "foo",
+		Subcommands: []*cli.Command{
+			{Name: "grep", ExecCode: func(args []string) int {
+				if len(args) > 0 && args[0] == "match" {
+					return 0
+				}
+				return 1
+			}},
+			{Name: "fail", Exec: func(args []string) error {
+				return errors.New("failed")
+			}},
+		},
+	}
+
+	tests := []struct {
+		args []string
+		code int
+		err  bool
+	}{
+		{args: []string{"grep", "match"}, code: 0},
+		{args: []string{"grep", "nomatch"}, code: 1},
+		{args: []string{"fail"}, code: cli.ExitError, err: true},
+		{args: []string{"--bad"}, code: cli.ExitUsage, err: true},
+		{args: []string{}, code: cli.ExitUsage, err: true},
+	}
+	for _, tc := range tests {
+		code, err := cli.RunCode(root, tc.args)
+		if code != tc.code {
+			t.Errorf("RunCode(root, %q) returned code %d; want %d",
+				tc.args, code, tc.code)
+		}
+		if (err != nil) != tc.err {
+			t.Errorf("RunCode(root, %q) returned error %v",
+				tc.args, err)
+		}
+	}
+
+	err := cli.Run(root, []string{"grep"})
+	var ce *cli.CodeError
+	if !errors.As(err, &ce) || ce.Code != 1 {
+		t.Errorf("Run(root, %q) returned error %v; want CodeError",
+			[]string{"grep"}, err)
+	}
+}
+
+func TestDisableDashDash(t *testing.T) {
+	var (
+		verbose bool
+		got     []string
+	)
+	cmd := &cli.Command{
+		Name: "wrap",
+		Options: []*cli.Option{
+			cli.BoolOption(&verbose, "verbose", 'v', "verbose"),
+		},
+		Exec: func(args []string) error {
+			got = args
+			return nil
+		},
+	}
+	args := []string{"-v", "--", "-x"}
+
+	if err := cli.Run(cmd, args); err != nil {
+		t.Fatalf("Run(cmd, %q) error %s", args, err)
+	}
+	if fmt.Sprintf("%q", got) != `["-x"]` {
+		t.Fatalf("Exec got %q; want %q", got, []string{"-x"})
+	}
+
+	cmd.DisableDashDash = true
+	if err := cli.Run(cmd, args); err != nil {
+		t.Fatalf("Run(cmd, %q) error %s", args, err)
+	}
+	if fmt.Sprintf("%q", got) != `["--" "-x"]` {
+		t.Fatalf("Exec got %q; want %q", got, []string{"--", "-x"})
+	}
+}
+
+func TestExternalPrefix(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test requires a POSIX shell")
+	}
+	dir := t.TempDir()
+	script := "#!/bin/sh\nexit $#\n"
+	err := os.WriteFile(filepath.Join(dir, "foo-bar"), []byte(script), 0755)
+	if err != nil {
+		t.Fatalf("WriteFile error %s", err)
+	}
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", dir)
+	defer os.Setenv("PATH", path)
+
+	root := &cli.Command{
+		Name:           "foo",
+		ExternalPrefix: "foo-",
+		Subcommands: []*cli.Command{
+			{Name: "baz", Exec: func(args []string) error { return nil }},
+		},
+	}
+	// The help option must not disable the external commands.
+	cli.AddHelpOption(root)
+
+	code, err := cli.RunCode(root, []string{"bar", "a", "b", "c"})
+	if code != 3 || err != nil {
+		t.Fatalf("RunCode(bar a b c) returned %d, %v; want %d, nil",
+			code, err, 3)
+	}
+	code, err = cli.RunCode(root, []string{"bar"})
+	if err != nil || code != cli.ExitOK {
+		t.Fatalf("RunCode(bar) returned %d, %v; want %d, nil",
+			code, err, cli.ExitOK)
+	}
+	code, err = cli.RunCode(root, []string{"qux"})
+	if err == nil || code != cli.ExitUsage {
+		t.Fatalf("RunCode(qux) returned %d, %v; want %d and error",
+			code, err, cli.ExitUsage)
+	}
+}
+
+func TestDebugCommand(t *testing.T) {
+	var (
+		verbose    bool
+		url, token string
+		n          int
+	)
+	os.Setenv("FOO_URL", "db://x")
+	defer os.Unsetenv("FOO_URL")
+	os.Setenv("FOO_TOKEN", "t0k3n")
+	defer os.Unsetenv("FOO_TOKEN")
+	os.Unsetenv("FOO_HOME")
+	urlOpt := cli.StringOption(&url, "url", 0, "database URL")
+	urlOpt.EnvVar = "FOO_URL"
+	tokenOpt := cli.StringOption(&token, "token", 0, "access token")
+	tokenOpt.EnvVar = "FOO_TOKEN"
+	tokenOpt.Secret = true
+	if err := cli.ApplyEnv([]*cli.Option{tokenOpt}); err != nil {
+		t.Fatalf("ApplyEnv error %s", err)
+	}
+	root := &cli.Command{
+		Name:    "foo",
+		Options: []*cli.Option{cli.BoolOption(&verbose, "verbose", 'v', "")},
+		Subcommands: []*cli.Command{
+			{
+				Name: "db",
+				Options: []*cli.Option{
+					urlOpt,
+					cli.IntOption(&n, "", 'n', "count"),
+					tokenOpt,
+				},
+				RequiredEnv: []string{"FOO_HOME"},
+				Exec:        func(args []string) error { return nil },
+			},
+		},
+	}
+	if !cli.AddDebugCommand(root) {
+		t.Fatalf("AddDebugCommand returned false")
+	}
+	if cli.AddDebugCommand(root) {
+		t.Fatalf("second AddDebugCommand returned true")
+	}
+
+	out, err := captureStdout(t, func() error {
+		return cli.Run(root, []string{"-v", "__debug"})
+	})
+	if err != nil {
+		t.Fatalf("Run error %s", err)
+	}
+	want := `foo
+    --verbose = true (command line)
+foo db
+    --url = "" (default)
+    -n = 0 (default)
+    --token = (secret) (environment)
+environment
+    FOO_URL set
+    FOO_TOKEN set
+    FOO_HOME unset
+`
+	if out != want {
+		t.Fatalf("got\n%s\nwant\n%s", out, want)
+	}
+
+	var sb strings.Builder
+	if _, err = root.WriteDoc(&sb); err != nil {
+		t.Fatalf("WriteDoc error %s", err)
+	}
+	if strings.Contains(sb.String(), "__debug") {
+		t.Fatalf("documentation lists hidden command:\n%s", sb.String())
+	}
+}
+
+func TestResolvePartial(t *testing.T) {
+	var (
+		verbose bool
+		url     string
+	)
+	exec := func(args []string) error { return nil }
+	migrate := &cli.Command{Name: "migrate", Exec: exec}
+	db := &cli.Command{
+		Name: "db",
+		Options: []*cli.Option{
+			cli.StringOption(&url, "url", 'u', "database URL"),
+		},
+		Subcommands: []*cli.Command{migrate},
+	}
+	root := &cli.Command{
+		Name: "foo",
+		Options: []*cli.Option{
+			cli.BoolOption(&verbose, "verbose", 'v', ""),
+		},
+		Subcommands: []*cli.Command{db},
+	}
+
+	tests := []struct {
+		args []string
+		cmd  *cli.Command
+		rest []string
+	}{
+		{nil, root, nil},
+		{[]string{"-v"}, root, nil},
+		{[]string{"-v", "db", "--url"}, db, []string{"--url"}},
+		{[]string{"db", "-u", "x", "mig"}, migrate, nil},
+		{[]string{"db", "--bogus", "migrate"}, db,
+			[]string{"--bogus", "migrate"}},
+		{[]string{"db", "zzz", "a"}, db, []string{"zzz", "a"}},
+		{[]string{"db", "migrate", "--"}, migrate, []string{"--"}},
+	}
+	for _, tc := range tests {
+		cmd, rest := cli.ResolvePartial(root, tc.args)
+		if cmd != tc.cmd {
+			t.Errorf("ResolvePartial(%q) returned command %s; want %s",
+				tc.args, cmd.Name, tc.cmd.Name)
+		}
+		if fmt.Sprint(rest) != fmt.Sprint(tc.rest) {
+			t.Errorf("ResolvePartial(%q) returned rest %q; want %q",
+				tc.args, rest, tc.rest)
+		}
+	}
+	if verbose || url != "" {
+		t.Errorf("ResolvePartial changed option values")
+	}
+}
+
+func TestPositionals(t *testing.T) {
+	tests := []struct {
+		args          []string
+		before, after []string
+	}{
+		{nil, nil, nil},
+		{[]string{"a", "-b"}, []string{"a", "-b"}, nil},
+		{[]string{"-v", "--", "-x", "--"},
+			[]string{"-v"}, []string{"-x", "--"}},
+		{[]string{"--"}, []string{}, []string{}},
+	}
+	for _, tc := range tests {
+		before, after := cli.Positionals(tc.args)
+		if fmt.Sprintf("%q %q", before, after) !=
+			fmt.Sprintf("%q %q", tc.before, tc.after) {
+			t.Errorf("Positionals(%q) returned %q, %q; want %q, %q",
+				tc.args, before, after, tc.before, tc.after)
+		}
+	}
+}
+
+func TestSubcommandProvider(t *testing.T) {
+	calls := 0
+	var executed string
+	exec := func(name string) func(args []string) error {
+		return func(args []string) error {
+			executed = name
+			return nil
+		}
+	}
+	root := &cli.Command{
+		Name: "foo",
+		Subcommands: []*cli.Command{
+			{Name: "list", Exec: exec("static list")},
+		},
+		SubcommandProvider: func() []*cli.Command {
+			calls++
+			return []*cli.Command{
+				{Name: "list", Exec: exec("plugin list")},
+				{Name: "plugin", Info: "a plugin",
+					Exec: exec("plugin")},
+			}
+		},
+	}
+
+	for _, tc := range []struct {
+		arg  string
+		want string
+	}{
+		{"plugin", "plugin"},
+		{"list", "static list"},
+	} {
+		if err := cli.Run(root, []string{tc.arg}); err != nil {
+			t.Fatalf("Run(%q) error %s", tc.arg, err)
+		}
+		if executed != tc.want {
+			t.Errorf("Run(%q) executed %q; want %q",
+				tc.arg, executed, tc.want)
+		}
+	}
+	var sb strings.Builder
+	if _, err := root.WriteDoc(&sb); err != nil {
+		t.Fatalf("WriteDoc error %s", err)
+	}
+	if !strings.Contains(sb.String(), "plugin - a plugin") {
+		t.Errorf("WriteDoc output doesn't list plugin:\n%s", sb.String())
+	}
+	if calls != 1 {
+		t.Errorf("provider called %d times; want %d", calls, 1)
+	}
+}
+
+func TestWriteDocSubcommandInfoWrapped(t *testing.T) {
+	info := strings.Repeat("word ", 30) + "end"
+	root := &cli.Command{
+		Name: "foo",
+		Subcommands: []*cli.Command{
+			{Name: "db", Info: "database commands"},
+			{Name: "long", Info: info},
+		},
+	}
+	var sb strings.Builder
+	if _, err := root.WriteDoc(&sb); err != nil {
+		t.Fatalf("WriteDoc error %s", err)
+	}
+	out := sb.String()
+	if !strings.Contains(out, "    db   - database commands\n") {
+		t.Errorf("short info not found in output:\n%s", out)
+	}
+	i := strings.Index(out, "    long - word")
+	if i < 0 {
+		t.Fatalf("long info not found in output:\n%s", out)
+	}
+	lines := strings.Split(strings.TrimSpace(out[i:]), "\n")
+	if len(lines) < 2 {
+		t.Fatalf("long info not wrapped:\n%s", out)
+	}
+	for j, line := range lines {
+		if len(line) > 84 {
+			t.Errorf("line %q has length %d > %d", line, len(line), 84)
+		}
+		if j > 0 && !strings.HasPrefix(line, "           word") &&
+			!strings.HasPrefix(line, "           end") {
+			t.Errorf("continuation line %q not aligned", line)
+		}
+	}
+}
+
+func TestOutputFormat(t *testing.T) {
+	var format string
+	root := &cli.Command{
+		Name: "foo",
+		Subcommands: []*cli.Command{
+			{Name: "list"},
+		},
+	}
+	root.Subcommands[0].Exec = func(args []string) error {
+		format = cli.OutputFormat(root.PersistentOptions)
+		return nil
+	}
+	if !cli.AddOutputFormatOption(root) {
+		t.Fatalf("AddOutputFormatOption returned false")
+	}
+	if cli.AddOutputFormatOption(root) {
+		t.Fatalf("second AddOutputFormatOption returned true")
+	}
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"list"}, "table"},
+		{[]string{"list", "-o", "json"}, "json"},
+		{[]string{"--output=yaml", "list"}, "yaml"},
+	}
+	for _, tc := range tests {
+		if err := cli.ResetOptions(root.PersistentOptions); err != nil {
+			t.Fatalf("ResetOptions error %s", err)
+		}
+		if err := cli.Run(root, tc.args); err != nil {
+			t.Fatalf("Run(%q) error %s", tc.args, err)
+		}
+		if format != tc.want {
+			t.Errorf("Run(%q) selected format %q; want %q",
+				tc.args, format, tc.want)
+		}
+	}
+
+	err := cli.Run(root, []string{"list", "-o", "jsonn"})
+	var oe *cli.OptionError
+	if !errors.As(err, &oe) || oe.Suggestion != "json" {
+		t.Fatalf("Run error %v; want suggestion %q", err, "json")
+	}
+}
+
+func TestCommandErrorIs(t *testing.T) {
+	var s string
+	root := &cli.Command{
+		Name: "foo",
+		Subcommands: []*cli.Command{
+			{
+				Name: "version",
+				Options: []*cli.Option{
+					cli.StringOption(&s, "s", 's', ""),
+				},
+				Exec: func(args []string) error { return nil },
+			},
+		},
+	}
+	err := cli.Run(root, []string{"version", "-s"})
+	if err == nil {
+		t.Fatalf("Run returned no error")
+	}
+	if !errors.Is(err, &cli.CommandError{Name: "version"}) {
+		t.Errorf("error %v doesn't match command version", err)
+	}
+	if errors.Is(err, &cli.CommandError{Name: "help"}) {
+		t.Errorf("error %v matches command help", err)
+	}
+	if !errors.Is(err, &cli.OptionError{Option: "s"}) {
+		t.Errorf("error %v doesn't match option s", err)
+	}
+}
+
+func TestHelpReturnsError(t *testing.T) {
+	sub := &cli.Command{
+		Name: "sub",
+		Exec: func(args []string) error { return nil },
+	}
+	root := &cli.Command{
+		Name:             "foo",
+		HelpReturnsError: true,
+		Subcommands:      []*cli.Command{sub},
+	}
+	cli.AddHelpCommand(root)
+	cli.AddHelpOptionToAll(root)
+
+	tests := []struct {
+		args []string
+		err  error
+		code int
+	}{
+		{[]string{"help", "sub"}, cli.ErrHelpRequested, cli.ExitOK},
+		{[]string{"sub", "-h"}, cli.ErrHelpRequested, cli.ExitOK},
+		{[]string{"sub", "--bad"}, nil, cli.ExitUsage},
+	}
+	for _, tc := range tests {
+		var code int
+		_, err := captureStdout(t, func() error {
+			err := cli.Run(root, tc.args)
+			code, _ = cli.RunCode(root, tc.args)
+			return err
+		})
+		if tc.err != nil && !errors.Is(err, tc.err) {
+			t.Errorf("Run(%q) error %v; want %v", tc.args, err, tc.err)
+		}
+		if code != tc.code {
+			t.Errorf("RunCode(%q) returned code %d; want %d",
+				tc.args, code, tc.code)
+		}
+		if err := cli.ResetOptions(sub.Options); err != nil {
+			t.Fatalf("ResetOptions error %s", err)
+		}
+	}
+}
+
+func TestPersistentOptionsEquals(t *testing.T) {
+	var (
+		config  string
+		level   int
+		verbose bool
+	)
+	sub := &cli.Command{
+		Name: "sub",
+		Exec: func(args []string) error { return nil },
+	}
+	root := &cli.Command{
+		Name: "foo",
+		PersistentOptions: []*cli.Option{
+			cli.StringOption(&config, "config", 'c', ""),
+			cli.IntOption(&level, "level", 'l', ""),
+			cli.BoolOption(&verbose, "verbose", 'v', ""),
+		},
+		Subcommands: []*cli.Command{sub},
+	}
+
+	for _, args := range [][]string{
+		{"--config=a.json", "--level=3", "sub"},
+		{"sub", "--config=a.json", "--level=3"},
+		{"--conf=a.json", "sub", "--lev=3"},
+		{"-c", "a.json", "sub", "-l", "3"},
+	} {
+		config, level = "", 0
+		if err := cli.Run(root, args); err != nil {
+			t.Fatalf("Run(root, %q) error %s", args, err)
+		}
+		if config != "a.json" || level != 3 {
+			t.Errorf("Run(root, %q): config=%q level=%d",
+				args, config, level)
+		}
+	}
+
+	// A flag doesn't accept a parameter at any position.
+	for _, args := range [][]string{
+		{"--verbose=true", "sub"},
+		{"sub", "--verbose=true"},
+	} {
+		err := cli.Run(root, args)
+		if !errors.Is(err, &cli.OptionError{Option: "verbose"}) {
+			t.Errorf("Run(root, %q) error %v; want error for verbose",
+				args, err)
+		}
+	}
+}
+
+func TestFuzzyCommands(t *testing.T) {
+	var executed string
+	exec := func(name string) func(args []string) error {
+		return func(args []string) error {
+			executed = name
+			return nil
+		}
+	}
+	root := &cli.Command{
+		Name:          "foo",
+		FuzzyCommands: true,
+		Subcommands: []*cli.Command{
+			{Name: "install", Exec: exec("install")},
+			{Name: "uninstall", Exec: exec("uninstall")},
+			{Name: "status", Exec: exec("status")},
+		},
+	}
+
+	for _, tc := range []struct {
+		arg  string
+		want string
+	}{
+		{"instl", "install"},
+		{"in", "install"},
+		{"stts", "status"},
+		{"unstl", "uninstall"},
+	} {
+		executed = ""
+		if err := cli.Run(root, []string{tc.arg}); err != nil {
+			t.Fatalf("Run(%q) error %s", tc.arg, err)
+		}
+		if executed != tc.want {
+			t.Errorf("Run(%q) executed %q; want %q",
+				tc.arg, executed, tc.want)
+		}
+	}
+
+	err := cli.Run(root, []string{"stl"})
+	if err == nil || !strings.Contains(err.Error(), "install, uninstall") {
+		t.Errorf("Run(%q) error %v; want candidates", "stl", err)
+	}
+
+	root.FuzzyCommands = false
+	if err := cli.Run(root, []string{"instl"}); err == nil {
+		t.Errorf("Run(%q) without FuzzyCommands returned no error",
+			"instl")
+	}
+}
+
+func TestHelpOptionGroup(t *testing.T) {
+	rank := &cli.Command{
+		Name: "rank",
+		Info: "ranking commands",
+		Subcommands: []*cli.Command{
+			{Name: "show", Exec: func(args []string) error { return nil }},
+		},
+	}
+	root := &cli.Command{
+		Name:        "foo",
+		Subcommands: []*cli.Command{rank},
+	}
+	cli.AddHelpCommand(root)
+	cli.AddHelpOptionToAll(root)
+	defer cli.ResetOptions(rank.Options)
+
+	want, err := captureStdout(t, func() error {
+		return cli.Run(root, []string{"help", "rank"})
+	})
+	if err != nil {
+		t.Fatalf("help rank error %s", err)
+	}
+	for _, args := range [][]string{{"rank", "-h"}, {"rank", "--help"}} {
+		out, err := captureStdout(t, func() error {
+			return cli.Run(root, args)
+		})
+		if err != nil {
+			t.Fatalf("Run(%q) error %s", args, err)
+		}
+		if out != want {
+			t.Errorf("Run(%q) output\n%s\nwant\n%s", args, out, want)
+		}
+		cli.ResetOptions(rank.Options)
+	}
+
+	code, err := cli.RunCode(root, []string{"rank"})
+	if err == nil || code != cli.ExitUsage {
+		t.Errorf("RunCode(rank) returned %d, %v; want %d and error",
+			code, err, cli.ExitUsage)
+	}
+	var ce *cli.CommandError
+	if !errors.As(err, &ce) || ce.Name != "rank" {
+		t.Errorf("RunCode(rank) error %v; want CommandError", err)
+	}
+}
+
+func TestRunMain(t *testing.T) {
+	var n int
+	db := &cli.Command{
+		Name:    "db",
+		Options: []*cli.Option{cli.IntOption(&n, "num", 'n', "")},
+		Exec: func(args []string) error {
+			if len(args) > 0 {
+				return errors.New("failure")
+			}
+			return nil
+		},
+	}
+	deploy := &cli.Command{
+		Name:      "deploy",
+		NoOptions: true,
+		PositionalArgs: []cli.ArgSpec{
+			{Name: "target", SetValue: func(arg string) error {
+				return nil
+			}},
+		},
+		Exec: func(args []string) error { return nil },
+	}
+	root := &cli.Command{
+		Name:        "foo",
+		Subcommands: []*cli.Command{db, deploy},
+	}
+	cli.AddHelpCommand(root)
+
+	tests := []struct {
+		args []string
+		code int
+		out  string
+	}{
+		{[]string{"db"}, cli.ExitOK, ""},
+		{[]string{"db", "x"}, cli.ExitError, "foo: failure\n"},
+		{[]string{"db", "-n", "x"}, cli.ExitUsage,
+			"foo: db: error setting value x for option n:" +
+				" strconv.ParseInt: parsing \"x\": invalid syntax\n" +
+				"usage: foo db [options]\n" +
+				"Run 'foo help db' for more information.\n"},
+		{[]string{"d"}, cli.ExitUsage,
+			"foo: ambiguous command d; candidates are db, deploy\n" +
+				"usage: foo\n" +
+				"Run 'foo help' for more information.\n"},
+		{[]string{"deploy", "-x"}, cli.ExitUsage,
+			"foo: command foo deploy accepts no options\n" +
+				"usage: foo deploy <target>\n" +
+				"Run 'foo help deploy' for more information.\n"},
+	}
+	for _, tc := range tests {
+		var sb strings.Builder
+		code := cli.RunMain(root, tc.args, &sb)
+		if code != tc.code {
+			t.Errorf("RunMain(%q) returned %d; want %d",
+				tc.args, code, tc.code)
+		}
+		if sb.String() != tc.out {
+			t.Errorf("RunMain(%q) wrote %q; want %q",
+				tc.args, sb.String(), tc.out)
+		}
+	}
+}
+
+func TestWriteDocNoDoubleBlankLines(t *testing.T) {
+	var (
+		verbose bool
+		n       int
+	)
+	root := &cli.Command{
+		Name: "foo",
+		Info: "test program",
+		Usage: `
+foo [options] <file>...
+foo [options] -
+`,
+		Description: `
+The program foo is used for testing.
+
+It has multiple paragraphs.
+
+	an indented block
+
+`,
+		Options: []*cli.Option{
+			cli.IntOption(&n, "num", 'n', "number\n\nwith two paragraphs\n"),
+			{Name: "empty", Description: ""},
+		},
+		PersistentOptions: []*cli.Option{
+			cli.BoolOption(&verbose, "verbose", 'v', "verbose output\n\n"),
+		},
+		PositionalArgs: []cli.ArgSpec{
+			{Name: "file", Description: "input file\n\n", Variadic: true},
+		},
+		Subcommands: []*cli.Command{
+			{Name: "list", Info: "lists everything"},
+			{Name: "quiet"},
+		},
+	}
+	cli.AddHelpCommand(root)
+
+	for _, cmd := range []*cli.Command{root, root.Subcommands[0]} {
+		var sb strings.Builder
+		if _, err := cmd.WriteDocIndented(&sb, "  "); err != nil {
+			t.Fatalf("WriteDoc error %s", err)
+		}
+		doc := sb.String()
+		blank := 0
+		for i, line := range strings.Split(doc, "\n") {
+			if strings.TrimSpace(line) != "" {
+				blank = 0
+				continue
+			}
+			blank++
+			if blank > 1 && i < strings.Count(doc, "\n") {
+				t.Fatalf("double blank line at line %d:\n%s",
+					i+1, doc)
+			}
+		}
+	}
+}
+
+func TestVersionOption(t *testing.T) {
+	root := &cli.Command{
+		Name:    "foo",
+		Version: "1.2.3",
+		Subcommands: []*cli.Command{
+			{Name: "list", Exec: func(args []string) error { return nil }},
+		},
+	}
+	if !cli.AddVersionOption(root) {
+		t.Fatalf("AddVersionOption returned false")
+	}
+	if cli.AddBuildInfoVersionOption(root) {
+		t.Fatalf("AddBuildInfoVersionOption returned true for second option")
+	}
+	if root.Exec != nil {
+		t.Fatalf("AddVersionOption installed an Exec function")
+	}
+	defer cli.ResetOptions(root.Options)
+
+	out, err := captureStdout(t, func() error {
+		return cli.Run(root, []string{"--version"})
+	})
+	if err != nil {
+		t.Fatalf("Run error %s", err)
+	}
+	if out != "foo 1.2.3\n" {
+		t.Errorf("--version printed %q; want %q", out, "foo 1.2.3\n")
+	}
+	cli.ResetOptions(root.Options)
+	if err = cli.Run(root, []string{"list"}); err != nil {
+		t.Errorf("Run(list) error %s", err)
+	}
+	if code, _ := cli.RunCode(root, nil); code != cli.ExitUsage {
+		t.Errorf("RunCode without subcommand returned %d; want %d",
+			code, cli.ExitUsage)
+	}
+
+	var output string
+	outOpt := cli.StringOption(&output, "output", 0, "output file")
+	outOpt.Required = true
+	root2 := &cli.Command{
+		Name:    "bar",
+		Version: "0.1",
+		Options: []*cli.Option{outOpt},
+	}
+	cli.AddBuildInfoVersionOption(root2)
+	out, err = captureStdout(t, func() error {
+		return cli.Run(root2, []string{"--version"})
+	})
+	if err != nil {
+		t.Fatalf("Run error %s", err)
+	}
+	if !strings.HasPrefix(out, "bar ") {
+		t.Errorf("--version printed %q", out)
+	}
+}
+
+func TestOptionRouting(t *testing.T) {
+	var rootOpt, subOpt bool
+	sub := &cli.Command{
+		Name: "sub",
+		Options: []*cli.Option{
+			cli.BoolOption(&subOpt, "sub-opt", 's', ""),
+		},
+		Exec: func(args []string) error { return nil },
+	}
+	root := &cli.Command{
+		Name: "foo",
+		Options: []*cli.Option{
+			cli.BoolOption(&rootOpt, "root-opt", 'r', ""),
+		},
+		Subcommands: []*cli.Command{sub},
+	}
+
+	args := []string{"--root-opt", "sub", "--sub-opt"}
+	if err := cli.Run(root, args); err != nil {
+		t.Fatalf("Run(%q) error %s", args, err)
+	}
+	if !rootOpt || !subOpt {
+		t.Fatalf("Run(%q): root-opt=%t sub-opt=%t", args, rootOpt, subOpt)
+	}
+
+	const hint = "it is an option of command foo and must precede sub"
+	tests := []struct {
+		args []string
+		hint bool
+	}{
+		{[]string{"sub", "--root-opt"}, true},
+		{[]string{"sub", "--root-opt=true"}, true},
+		{[]string{"sub", "-r"}, true},
+		{[]string{"sub", "-sr"}, true},
+		{[]string{"sub", "--bogus"}, false},
+		{[]string{"--sub-opt", "sub"}, false},
+	}
+	for _, tc := range tests {
+		err := cli.Run(root, tc.args)
+		if err == nil {
+			t.Errorf("Run(%q) returned no error", tc.args)
+			continue
+		}
+		if strings.Contains(err.Error(), hint) != tc.hint {
+			t.Errorf("Run(%q) error %q; hint expected %t",
+				tc.args, err, tc.hint)
+		}
+	}
+}
+
+func TestVerbosity(t *testing.T) {
+	root := &cli.Command{
+		Name: "foo",
+		Subcommands: []*cli.Command{
+			{Name: "run", Exec: func(args []string) error { return nil }},
+		},
+	}
+	v := cli.AddVerbosityOptions(root)
+	var sb strings.Builder
+	v.Output = &sb
+
+	tests := []struct {
+		args  []string
+		level int
+		out   string
+	}{
+		{[]string{"run"}, cli.LevelNormal, "normal\n"},
+		{[]string{"-v", "run"}, cli.LevelVerbose, "normal\nverbose\n"},
+		{[]string{"run", "-vv"}, cli.LevelDebug,
+			"normal\nverbose\ndebug\n"},
+		{[]string{"-q", "run", "-v"}, cli.LevelQuiet, ""},
+	}
+	for _, tc := range tests {
+		if err := cli.ResetOptions(root.PersistentOptions); err != nil {
+			t.Fatalf("ResetOptions error %s", err)
+		}
+		if err := cli.Run(root, tc.args); err != nil {
+			t.Fatalf("Run(%q) error %s", tc.args, err)
+		}
+		if l := v.Level(); l != tc.level {
+			t.Errorf("Run(%q): level %d; want %d", tc.args, l, tc.level)
+		}
+		sb.Reset()
+		v.Printf(cli.LevelNormal, "normal")
+		v.Printf(cli.LevelVerbose, "verbose\n")
+		v.Printf(cli.LevelDebug, "%s", "debug")
+		if sb.String() != tc.out {
+			t.Errorf("Run(%q): output %q; want %q",
+				tc.args, sb.String(), tc.out)
+		}
+	}
+}
+
+func TestFormatErrorList(t *testing.T) {
+	var n int
+	root := &cli.Command{
+		Name: "foo",
+		Subcommands: []*cli.Command{
+			{
+				Name: "bar",
+				Options: []*cli.Option{
+					cli.IntOption(&n, "num", 'n', "number"),
+				},
+				Exec: func(args []string) error { return nil },
+			},
+		},
+	}
+
+	err := cli.Run(root, []string{"bar", "--x", "-n", "a", "--y"})
+	errs := cli.Errors(err)
+	if len(errs) != 3 {
+		t.Fatalf("Errors returned %d errors; want %d", len(errs), 3)
+	}
+	for i, e := range errs {
+		if !strings.HasPrefix(e.Error(), "bar: ") {
+			t.Errorf("error %d %q doesn't name the command", i, e)
+		}
+	}
+	var sb strings.Builder
+	cli.FormatErrorList(err, &sb)
+	lines := strings.Split(strings.TrimSuffix(sb.String(), "\n"), "\n")
+	if len(lines) != 4 || lines[0] != "3 errors:" {
+		t.Fatalf("FormatErrorList wrote %q", sb.String())
+	}
+	for i, line := range lines[1:] {
+		prefix := fmt.Sprintf("  %d. bar: ", i+1)
+		if !strings.HasPrefix(line, prefix) {
+			t.Errorf("line %q doesn't start with %q", line, prefix)
+		}
+	}
+
+	sb.Reset()
+	err = cli.Run(root, []string{"bar", "--x"})
+	cli.FormatErrorList(err, &sb)
+	if want := err.Error() + "\n"; sb.String() != want {
+		t.Errorf("FormatErrorList wrote %q; want %q", sb.String(), want)
+	}
+	if errs = cli.Errors(nil); errs != nil {
+		t.Errorf("Errors(nil) returned %v; want nil", errs)
+	}
+}
+
+func TestLenientBooleans(t *testing.T) {
+	var flag bool
+	var count int
+	root := &cli.Command{
+		Name: "foo",
+		Options: []*cli.Option{
+			cli.BoolOption(&flag, "flag", 'f', ""),
+			cli.CountOption(&count, "count", 'c', ""),
+		},
+		LenientBooleans: true,
+		Exec:            func(args []string) error { return nil },
+	}
+
+	tests := []struct {
+		args    []string
+		lenient bool
+		want    bool
+		err     bool
+	}{
+		{args: []string{"--flag"}, lenient: true, want: true},
+		{args: []string{"--flag=true"}, lenient: true, want: true},
+		{args: []string{"--flag=false"}, lenient: true, want: false},
+		{args: []string{"--flag", "--flag=0"}, lenient: true,
+			want: false},
+		{args: []string{"--fl=T"}, lenient: true, want: true},
+		{args: []string{"--flag=yes"}, lenient: true, err: true},
+		{args: []string{"-f=true"}, lenient: true, err: true},
+		{args: []string{"--count=1"}, lenient: true, err: true},
+		{args: []string{"--flag=true"}, err: true},
+	}
+	for _, tc := range tests {
+		if err := cli.ResetOptions(root.Options); err != nil {
+			t.Fatalf("ResetOptions error %s", err)
+		}
+		flag = !tc.want
+		root.LenientBooleans = tc.lenient
+		err := cli.Run(root, tc.args)
+		if tc.err {
+			if err == nil {
+				t.Errorf("Run(%q) lenient=%t returned no error",
+					tc.args, tc.lenient)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Run(%q) error %s", tc.args, err)
+			continue
+		}
+		if flag != tc.want {
+			t.Errorf("Run(%q) set flag to %t; want %t",
+				tc.args, flag, tc.want)
+		}
+	}
+}
+
+func TestRunContext(t *testing.T) {
+	root := &cli.Command{
+		Name: "foo",
+		Subcommands: []*cli.Command{
+			{
+				Name: "wait",
+				ExecContext: func(ctx context.Context, args []string) error {
+					select {
+					case <-ctx.Done():
+						return ctx.Err()
+					case <-time.After(10 * time.Second):
+						return nil
+					}
+				},
+			},
+			{Name: "old", Exec: func(args []string) error { return nil }},
+		},
+	}
+	cli.AddHelpOptionToAll(root)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	start := time.Now()
+	err := cli.RunContext(ctx, root, []string{"wait"})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("RunContext error %v; want %v", err, context.Canceled)
+	}
+	if d := time.Since(start); d >= 5*time.Second {
+		t.Fatalf("RunContext returned after %s", d)
+	}
+
+	if err = cli.RunContext(ctx, root, []string{"old"}); err != nil {
+		t.Fatalf("RunContext(old) error %s", err)
+	}
+
+	out, err := captureStdout(t, func() error {
+		return cli.Run(root, []string{"wait", "-h"})
+	})
+	if err != nil {
+		t.Fatalf("Run(wait -h) error %s", err)
+	}
+	if !strings.Contains(out, "wait") {
+		t.Fatalf("Run(wait -h) printed %q", out)
+	}
+}
+
+func TestDryRunOption(t *testing.T) {
+	var ctxDryRun bool
+	root := &cli.Command{
+		Name: "foo",
+		Subcommands: []*cli.Command{
+			{
+				Name: "deploy",
+				Subcommands: []*cli.Command{
+					{
+						Name: "app",
+						ExecContext: func(ctx context.Context, args []string) error {
+							ctxDryRun = cli.DryRun(ctx)
+							return nil
+						},
+					},
+				},
+			},
+		},
+	}
+	dryRun := cli.AddDryRunOption(root)
+	if dryRun == nil {
+		t.Fatalf("AddDryRunOption returned nil")
+	}
+	if cli.AddDryRunOption(root) != nil {
+		t.Fatalf("second AddDryRunOption returned flag")
+	}
+
+	tests := []struct {
+		args []string
+		want bool
+	}{
+		{[]string{"deploy", "app"}, false},
+		{[]string{"--dry-run", "deploy", "app"}, true},
+		{[]string{"deploy", "-n", "app"}, true},
+		{[]string{"deploy", "app", "--dry-run"}, true},
+	}
+	for _, tc := range tests {
+		if err := cli.ResetOptions(root.PersistentOptions); err != nil {
+			t.Fatalf("ResetOptions error %s", err)
+		}
+		ctxDryRun = !tc.want
+		if err := cli.Run(root, tc.args); err != nil {
+			t.Fatalf("Run(%q) error %s", tc.args, err)
+		}
+		if *dryRun != tc.want || ctxDryRun != tc.want {
+			t.Errorf("Run(%q) flag %t, DryRun %t; want %t",
+				tc.args, *dryRun, ctxDryRun, tc.want)
+		}
+	}
+	if cli.DryRun(context.Background()) {
+		t.Errorf("DryRun(context.Background()) returned true")
+	}
+}
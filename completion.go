@@ -0,0 +1,348 @@
+// SPDX-FileCopyrightText: © 2021 Ulrich Kunitz
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// shellFunc returns a name for a shell function by prefixing s with an
+// underscore and replacing all characters that are not ASCII letters or digits
+// by underscores.
+func shellFunc(s string) string {
+	var sb strings.Builder
+	sb.WriteString("_")
+	for _, c := range s {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z',
+			'0' <= c && c <= '9':
+			sb.WriteRune(c)
+		default:
+			sb.WriteByte('_')
+		}
+	}
+	return sb.String()
+}
+
+// shellQuote quotes s for the shell using single quotes.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// completionEntry describes the completions for a command path.
+type completionEntry struct {
+	// path consists of the names of the commands from the root.
+	path string
+	// keys are the paths of the parent followed by one of the names of
+	// the command.
+	keys []string
+	cmd  *Command
+	// options are the options of the command and the persistent options
+	// of its parents.
+	options []*Option
+	// topics marks an entry for the help command, which completes the
+	// subcommands of cmd as help topics.
+	topics bool
+}
+
+// subcommands returns the subcommands to complete. Help topics don't include
+// hidden commands and the help command.
+func (e *completionEntry) subcommands() []*Command {
+	if !e.topics {
+		return e.cmd.Subcommands
+	}
+	var commands []*Command
+	for _, c := range e.cmd.Subcommands {
+		if !c.Hidden && !c.help {
+			commands = append(commands, c)
+		}
+	}
+	return commands
+}
+
+// commandNames returns the names of the subcommands.
+func (e *completionEntry) commandNames() []string {
+	var names []string
+	for _, c := range e.subcommands() {
+		names = append(names, c.AllNames()...)
+	}
+	return names
+}
+
+// optionNames returns the long names of the options including the negated
+// names.
+func (e *completionEntry) optionNames() []string {
+	var names []string
+	for _, o := range e.options {
+		for _, name := range o.AllNames() {
+			names = append(names, "--"+name)
+			if o.Negatable && !o.HasParam {
+				names = append(names, "--no-"+name)
+			}
+		}
+	}
+	return names
+}
+
+// completionEntries walks the command tree and appends an entry for every
+// command.
+func completionEntries(entries []completionEntry, cmd *Command, parent string, inherited []*Option) []completionEntry {
+	cmd.loadSubcommands()
+	e := completionEntry{path: cmd.Name, cmd: cmd}
+	if parent != "" {
+		e.path = parent + " " + cmd.Name
+		for _, name := range cmd.AllNames() {
+			e.keys = append(e.keys, parent+" "+name)
+		}
+	}
+	e.options = append(cmd.localOptions(), inherited...)
+	entries = append(entries, e)
+	inherited = append(inherited, cmd.PersistentOptions...)
+	for _, c := range cmd.Subcommands {
+		if c.help {
+			entries = helpEntries(entries, c, cmd, e.path,
+				inherited)
+			continue
+		}
+		entries = completionEntries(entries, c, e.path, inherited)
+	}
+	return entries
+}
+
+// helpEntries appends the entry for the help command of cmd and the entries
+// for the help topics, which mirror the command tree below cmd.
+func helpEntries(entries []completionEntry, help, cmd *Command, parent string, inherited []*Option) []completionEntry {
+	e := completionEntry{
+		path:    parent + " " + help.Name,
+		cmd:     cmd,
+		options: append(help.localOptions(), inherited...),
+		topics:  true,
+	}
+	for _, name := range help.AllNames() {
+		e.keys = append(e.keys, parent+" "+name)
+	}
+	return topicEntries(append(entries, e), &e)
+}
+
+// topicEntries appends the entries for the help topics below the topic entry
+// e.
+func topicEntries(entries []completionEntry, e *completionEntry) []completionEntry {
+	for _, c := range e.subcommands() {
+		c.loadSubcommands()
+		t := completionEntry{
+			path:    e.path + " " + c.Name,
+			cmd:     c,
+			options: e.options,
+			topics:  true,
+		}
+		for _, name := range c.AllNames() {
+			t.keys = append(t.keys, e.path+" "+name)
+		}
+		entries = append(entries, t)
+		entries = topicEntries(entries, &t)
+	}
+	return entries
+}
+
+// WriteBashCompletion writes a bash completion script for the root command to
+// w. The script offers the names of the subcommands and the long names of the
+// options at each level of the command tree including hidden commands and the
+// help command. The help command completes the names of the visible commands
+// as topics. Options of a command must precede its subcommands. The script
+// can be sourced by bash or installed in the directory for completion scripts,
+// e.g. /etc/bash_completion.d.
+func WriteBashCompletion(w io.Writer, root *Command) error {
+	entries := completionEntries(nil, root, "", nil)
+	f := shellFunc(root.Name) + "_complete"
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# bash completion for %s\n\n", root.Name)
+	fmt.Fprintf(&sb, "%s() {\n", f)
+	sb.WriteString("\tlocal cur=\"${COMP_WORDS[COMP_CWORD]}\"\n")
+	fmt.Fprintf(&sb, "\tlocal path=%s word i\n", shellQuote(root.Name))
+	sb.WriteString("\tfor ((i = 1; i < COMP_CWORD; i++)); do\n")
+	sb.WriteString("\t\tword=\"${COMP_WORDS[i]}\"\n")
+	sb.WriteString("\t\tcase \"$path $word\" in\n")
+	for _, e := range entries[1:] {
+		patterns := make([]string, len(e.keys))
+		for i, key := range e.keys {
+			patterns[i] = shellQuote(key)
+		}
+		fmt.Fprintf(&sb, "\t\t%s) path=%s ;;\n",
+			strings.Join(patterns, "|"), shellQuote(e.path))
+	}
+	sb.WriteString("\t\tesac\n")
+	sb.WriteString("\tdone\n")
+	sb.WriteString("\tlocal commands=\"\" options=\"\"\n")
+	sb.WriteString("\tcase \"$path\" in\n")
+	for i := range entries {
+		e := &entries[i]
+		fmt.Fprintf(&sb, "\t%s)\n", shellQuote(e.path))
+		fmt.Fprintf(&sb, "\t\tcommands=%s\n",
+			shellQuote(strings.Join(e.commandNames(), " ")))
+		fmt.Fprintf(&sb, "\t\toptions=%s\n",
+			shellQuote(strings.Join(e.optionNames(), " ")))
+		sb.WriteString("\t\t;;\n")
+	}
+	sb.WriteString("\tesac\n")
+	sb.WriteString("\tif [[ \"$cur\" == -* ]]; then\n")
+	sb.WriteString("\t\tCOMPREPLY=($(compgen -W \"$options\" -- \"$cur\"))\n")
+	sb.WriteString("\telse\n")
+	sb.WriteString("\t\tCOMPREPLY=($(compgen -W \"$commands\" -- \"$cur\"))\n")
+	sb.WriteString("\tfi\n")
+	sb.WriteString("}\n\n")
+	fmt.Fprintf(&sb, "complete -F %s %s\n", f, shellQuote(root.Name))
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// completionText returns the description s on a single line with the white
+// space collapsed, as required for the hints of the completion scripts. The
+// characters special to the shell must be escaped by the generators.
+func completionText(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// zshEscaper escapes the characters with a special meaning in the option specs
+// of _arguments.
+var zshEscaper = strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`,
+	":", `\:`)
+
+// zshText returns the text on a single line with the characters special to
+// _arguments escaped.
+func zshText(s string) string {
+	return zshEscaper.Replace(completionText(s))
+}
+
+// zshOptionSpecs returns the _arguments specs for the option.
+func zshOptionSpecs(o *Option) []string {
+	var desc string
+	if d := zshText(o.Description); d != "" {
+		desc = "[" + d + "]"
+	}
+	var action string
+	if o.HasParam {
+		typ := o.Placeholder
+		if typ == "" {
+			typ = o.ParamType
+		}
+		if typ == "" {
+			typ = "param"
+		}
+		files := " "
+		if o.ParamType == "path" {
+			files = "_files"
+		}
+		action = ":" + zshText(typ) + ":" + files
+		if o.OptionalParam {
+			action = ":" + action
+		}
+	}
+	repeat := ""
+	if o.Repeatable {
+		repeat = "*"
+	}
+	var specs []string
+	for _, r := range o.AllShorts() {
+		specs = append(specs, repeat+"-"+string(r)+desc+action)
+	}
+	for _, name := range o.AllNames() {
+		switch {
+		case !o.HasParam:
+			specs = append(specs, repeat+"--"+name+desc)
+			if o.Negatable {
+				specs = append(specs, "--no-"+name+desc)
+			}
+		case o.RequireEquals:
+			specs = append(specs, repeat+"--"+name+"=-"+desc+action)
+		default:
+			specs = append(specs, repeat+"--"+name+"="+desc+action)
+		}
+	}
+	return specs
+}
+
+// WriteZshCompletion writes a zsh completion script for the root command to w.
+// The script describes the subcommands by their Info field and the options by
+// their descriptions. Parameters of options are described by their
+// placeholder or parameter type; paths are completed as files. Hidden
+// commands and the help command are included; the help command completes the
+// visible commands as topics. The script can be installed as
+// file _<name> in a directory of $fpath or sourced after compinit.
+func WriteZshCompletion(w io.Writer, root *Command) error {
+	entries := completionEntries(nil, root, "", nil)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "#compdef %s\n", root.Name)
+	for i := range entries {
+		e := &entries[i]
+		fmt.Fprintf(&sb, "\n%s() {\n", shellFunc(e.path))
+		var specs []string
+		for _, o := range e.options {
+			specs = append(specs, zshOptionSpecs(o)...)
+		}
+		subcommands := e.subcommands()
+		if len(subcommands) == 0 {
+			if !e.topics {
+				specs = append(specs, "*:argument:_files")
+			}
+			sb.WriteString("\t_arguments -s")
+			for _, spec := range specs {
+				fmt.Fprintf(&sb, " \\\n\t\t%s", shellQuote(spec))
+			}
+			sb.WriteString("\n}\n")
+			continue
+		}
+		specs = append(specs, "1: :->command", "*:: :->args")
+		sb.WriteString("\tlocal context state state_descr line\n")
+		sb.WriteString("\ttypeset -A opt_args\n")
+		sb.WriteString("\t_arguments -s -C")
+		for _, spec := range specs {
+			fmt.Fprintf(&sb, " \\\n\t\t%s", shellQuote(spec))
+		}
+		sb.WriteString("\n\tcase $state in\n")
+		sb.WriteString("\tcommand)\n")
+		sb.WriteString("\t\tlocal -a commands\n")
+		sb.WriteString("\t\tcommands=(\n")
+		for _, c := range subcommands {
+			info := completionText(c.Info)
+			for _, name := range c.AllNames() {
+				name = strings.ReplaceAll(name, ":", `\:`)
+				fmt.Fprintf(&sb, "\t\t\t%s\n",
+					shellQuote(name+":"+info))
+			}
+		}
+		sb.WriteString("\t\t)\n")
+		sb.WriteString("\t\t_describe -t commands command commands\n")
+		sb.WriteString("\t\t;;\n")
+		sb.WriteString("\targs)\n")
+		sb.WriteString("\t\tcase $words[1] in\n")
+		for _, c := range subcommands {
+			var patterns []string
+			for _, name := range c.AllNames() {
+				patterns = append(patterns, shellQuote(name))
+			}
+			fmt.Fprintf(&sb, "\t\t%s) %s ;;\n",
+				strings.Join(patterns, "|"),
+				shellFunc(e.path+" "+c.Name))
+		}
+		sb.WriteString("\t\tesac\n")
+		sb.WriteString("\t\t;;\n")
+		sb.WriteString("\tesac\n")
+		sb.WriteString("}\n")
+	}
+	f := shellFunc(root.Name)
+	fmt.Fprintf(&sb, "\nif [ \"$funcstack[1]\" = %s ]; then\n", shellQuote(f))
+	fmt.Fprintf(&sb, "\t%s \"$@\"\n", f)
+	sb.WriteString("else\n")
+	fmt.Fprintf(&sb, "\tcompdef %s %s\n", f, shellQuote(root.Name))
+	sb.WriteString("fi\n")
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
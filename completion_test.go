@@ -0,0 +1,205 @@
+// SPDX-FileCopyrightText: © 2021 Ulrich Kunitz
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ulikunitz/cli"
+)
+
+func completionRoot() *cli.Command {
+	var verbose, force, color bool
+	var output string
+	exec := func(args []string) error { return nil }
+	root := &cli.Command{
+		Name: "tool",
+		PersistentOptions: []*cli.Option{
+			cli.BoolOption(&verbose, "verbose", 'v', ""),
+		},
+		Options: []*cli.Option{
+			cli.NegatableBoolOption(&color, "color", 0, ""),
+		},
+		Subcommands: []*cli.Command{
+			{
+				Name:  "database",
+				Names: []string{"db"},
+				Subcommands: []*cli.Command{
+					{
+						Name: "migrate",
+						Options: []*cli.Option{
+							cli.BoolOption(&force, "force",
+								'f', ""),
+						},
+						Exec: exec,
+					},
+				},
+			},
+			{
+				Name: "export",
+				Options: []*cli.Option{
+					cli.StringOption(&output, "output", 'o', ""),
+				},
+				Exec: exec,
+			},
+			{Name: "internal", Hidden: true, Exec: exec},
+		},
+	}
+	cli.AddHelpCommand(root)
+	return root
+}
+
+func TestWriteBashCompletion(t *testing.T) {
+	var sb strings.Builder
+	if err := cli.WriteBashCompletion(&sb, completionRoot()); err != nil {
+		t.Fatalf("WriteBashCompletion error %s", err)
+	}
+	script := sb.String()
+	for _, s := range []string{
+		"database", "db", "migrate", "export", "internal", "help",
+		"--verbose", "--color", "--no-color", "--force", "--output",
+		"complete -F _tool_complete 'tool'",
+	} {
+		if !strings.Contains(script, s) {
+			t.Errorf("script doesn't contain %q", s)
+		}
+	}
+
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skipf("bash not found")
+	}
+	path := filepath.Join(t.TempDir(), "tool.bash")
+	if err = os.WriteFile(path, []byte(script), 0644); err != nil {
+		t.Fatalf("WriteFile error %s", err)
+	}
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"tool ", "database db export internal help"},
+		{"tool d", "database db"},
+		{"tool --", "--color --no-color --verbose"},
+		{"tool db ", "migrate"},
+		{"tool -v database migrate --", "--force --verbose"},
+		{"tool export --o", "--output"},
+		{"tool help ", "database db export"},
+		{"tool help db ", "migrate"},
+		{"tool help database m", "migrate"},
+		{"tool help database migrate ", ""},
+		{"tool help --", "--format --verbose"},
+	}
+	for _, tc := range tests {
+		words := strings.Split(tc.line, " ")
+		var quoted []string
+		for _, w := range words {
+			quoted = append(quoted, "'"+w+"'")
+		}
+		code := "source " + path + "\n" +
+			"COMP_WORDS=(" + strings.Join(quoted, " ") + ")\n" +
+			"COMP_CWORD=" + strconv.Itoa(len(words)-1) + "\n" +
+			"_tool_complete\n" +
+			`echo "${COMPREPLY[*]}"` + "\n"
+		out, err := exec.Command(bash, "--norc", "-c", code).CombinedOutput()
+		if err != nil {
+			t.Fatalf("bash error %s: %s", err, out)
+		}
+		if got := strings.TrimSpace(string(out)); got != tc.want {
+			t.Errorf("completion of %q is %q; want %q",
+				tc.line, got, tc.want)
+		}
+	}
+}
+
+func TestWriteZshCompletion(t *testing.T) {
+	root := completionRoot()
+	var sb strings.Builder
+	if err := cli.WriteZshCompletion(&sb, root); err != nil {
+		t.Fatalf("WriteZshCompletion error %s", err)
+	}
+	script := sb.String()
+	for _, s := range []string{
+		"#compdef tool\n",
+		"_tool() {",
+		"_tool_database_migrate() {",
+		`'database:'`,
+		`'db:'`,
+		`'internal:'`,
+		`'help:prints help messages'`,
+		`'--color'`,
+		`'--no-color'`,
+		`'--output=:string: '`,
+		`'-o:string: '`,
+		`'database'|'db') _tool_database ;;`,
+		`'database'|'db') _tool_help_database ;;`,
+		"_tool_help_database_migrate() {\n\t_arguments -s" +
+			" \\\n\t\t'--format=[output format",
+		"compdef _tool 'tool'",
+	} {
+		if !strings.Contains(script, s) {
+			t.Errorf("script doesn't contain %q", s)
+		}
+	}
+	i := strings.Index(script, "_tool_help() {")
+	if i < 0 {
+		t.Fatalf("script doesn't contain function _tool_help")
+	}
+	help := script[i:]
+	help = help[:strings.Index(help, "\n}\n")]
+	if strings.Contains(help, "'internal:") {
+		t.Errorf("help topics contain hidden command:\n%s", help)
+	}
+	zsh, err := exec.LookPath("zsh")
+	if err != nil {
+		return
+	}
+	out, err := exec.Command(zsh, "-n", "-c", script).CombinedOutput()
+	if err != nil {
+		t.Fatalf("zsh -n error %s: %s", err, out)
+	}
+}
+
+func TestZshCompletionDescriptions(t *testing.T) {
+	root := completionRoot()
+	root.Subcommands[0].Info = "manages the database: migrations & backups"
+	var path string
+	root.Subcommands[1].Options = append(root.Subcommands[1].Options,
+		cli.PathOption(&path, "config", 'c',
+			"reads the [optional] config\nfile; see `man tool` for"+
+				" $HOME's \\ settings"))
+
+	var sb strings.Builder
+	if err := cli.WriteZshCompletion(&sb, root); err != nil {
+		t.Fatalf("WriteZshCompletion error %s", err)
+	}
+	script := sb.String()
+	for _, s := range []string{
+		`'database:manages the database: migrations & backups'`,
+		`'db:manages the database: migrations & backups'`,
+		`'--config=[reads the \[optional\] config file; see ` +
+			"`man tool`" + ` for $HOME'\''s \\ settings]:path:_files'`,
+	} {
+		if !strings.Contains(script, s) {
+			t.Errorf("script doesn't contain %q", s)
+		}
+	}
+	if strings.Contains(script, "config\nfile") {
+		t.Errorf("script contains newline of description")
+	}
+
+	zsh, err := exec.LookPath("zsh")
+	if err != nil {
+		return
+	}
+	out, err := exec.Command(zsh, "-n", "-c", script).CombinedOutput()
+	if err != nil {
+		t.Fatalf("zsh -n error %s: %s", err, out)
+	}
+}
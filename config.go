@@ -0,0 +1,292 @@
+// SPDX-FileCopyrightText: © 2021 Ulrich Kunitz
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultConfigPath returns the conventional path of the configuration file
+// for the application, which is config.json in the directory appName below the
+// user configuration directory. On Unix systems this is
+// $XDG_CONFIG_HOME/<appName>/config.json or
+// $HOME/.config/<appName>/config.json. See os.UserConfigDir for other
+// systems. The function returns an empty string if the configuration directory
+// cannot be determined. It doesn't check whether the file exists. Run loads
+// the file if the DefaultConfig field of the root command is set.
+func DefaultConfigPath(appName string) string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, appName, "config.json")
+}
+
+// loadDefaultConfig loads the file DefaultConfigPath for the options of the
+// commands selected if the DefaultConfig field of the root command is set. The
+// file is not loaded if it doesn't exist, help has been requested or an option
+// config has been given.
+func loadDefaultConfig(commands []*Command) error {
+	root := commands[0]
+	if !root.DefaultConfig || helpRequested(commands) {
+		return nil
+	}
+	var options []*Option
+	for _, cmd := range commands {
+		options = append(options, cmd.localOptions()...)
+	}
+	if o := findOption(options, "config"); o != nil && o.seen {
+		return nil
+	}
+	path := DefaultConfigPath(root.Name)
+	if path == "" {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+	return loadOptions(options, treeOptions(root), f, path)
+}
+
+// treeOptions returns the options of all commands of the tree.
+func treeOptions(cmd *Command) []*Option {
+	options := cmd.localOptions()
+	for _, c := range cmd.Subcommands {
+		options = append(options, treeOptions(c)...)
+	}
+	return options
+}
+
+// LoadOptionsFile sets the options from the file at path. Each line of the
+// file has the form "name = value" or consists only of the name of a flag.
+// The names are the long names of the options without leading dashes; short
+// names and negated names prefixed by no- are rejected as unknown. Values
+// enclosed in double quotes are unquoted as Go string literals. Blank lines
+// and lines starting with # are ignored. Errors are reported as OptionError
+// with a message containing the path and the line number.
+//
+// A file with the extension .json, like the one of DefaultConfigPath, must
+// contain a JSON object mapping the long names to strings, numbers, booleans
+// or arrays of them. The elements of an array are set in order, which is
+// useful for repeatable options. Null values are ignored.
+//
+// Options that have been set since the last parse or reset are not changed,
+// so that the command line takes precedence. Call the function after
+// ParseOptions with the flag SkipRequired and before CheckRequired; a parse
+// following the call forgets that the options have been set.
+func LoadOptionsFile(options []*Option, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return loadOptions(options, nil, f, path)
+}
+
+// ApplyEnv sets the options that haven't been set since their last reset from
+// the environment variables named by their EnvVar fields. Call it after
+// parsing, so that options given on the command line take precedence. Parse
+// and Run call it for the options of the commands selected. Unset
+// environment variables are ignored, while empty ones provide an empty
+// parameter. Empty variables are ignored as well for options without
+// parameter, e.g. flags created by BoolOption. All errors are collected and
+// reported as OptionError.
+func ApplyEnv(options []*Option) error {
+	var errList errorList
+	for _, o := range options {
+		if o.EnvVar == "" || o.seen {
+			continue
+		}
+		value, ok := os.LookupEnv(o.EnvVar)
+		if !ok || (value == "" && !o.HasParam) {
+			continue
+		}
+		name := o.Name
+		if name == "" {
+			name = string(o.Short)
+		}
+		if err := o.set(sourceEnv, name, value, false); err != nil {
+			errList = append(errList, &OptionError{
+				Option: name,
+				Msg: fmt.Sprintf(
+					"error setting value %q of $%s for option %s",
+					value, o.EnvVar, o.dashName(name)),
+				Wrapped:    err,
+				Suggestion: suggestionOf(err),
+			})
+		}
+	}
+	return errList.Flatten()
+}
+
+// fileEntry is an option setting read from an options file.
+type fileEntry struct {
+	// pos is the position in the file used in error messages.
+	pos      string
+	name     string
+	value    string
+	hasValue bool
+}
+
+// loadOptions reads the options file from r and sets the options. Names of the
+// options in known are accepted, but the options are not set. The path is
+// used in error messages and selects the format of the file.
+func loadOptions(options, known []*Option, r io.Reader, path string) error {
+	var (
+		entries []fileEntry
+		err     error
+	)
+	if filepath.Ext(path) == ".json" {
+		entries, err = readJSONOptions(r, path)
+	} else {
+		entries, err = readOptionLines(r, path)
+	}
+	if err != nil {
+		return err
+	}
+	given := make(map[*Option]bool)
+	for _, o := range options {
+		if o.seen {
+			given[o] = true
+		}
+	}
+	for _, e := range entries {
+		opt := findOption(options, e.name)
+		if opt == nil {
+			if findOption(known, e.name) != nil {
+				continue
+			}
+			return &OptionError{
+				Option: e.name,
+				Msg: fmt.Sprintf("%s: unknown option %s",
+					e.pos, e.name),
+			}
+		}
+		if !e.hasValue && opt.HasParam && !opt.OptionalParam {
+			return &OptionError{
+				Option: e.name,
+				Msg: fmt.Sprintf("%s: option %s requires a value",
+					e.pos, e.name),
+			}
+		}
+		if given[opt] {
+			continue
+		}
+		if err = opt.set("file "+path, e.name, e.value,
+			!e.hasValue); err != nil {
+			return &OptionError{
+				Option: e.name,
+				Msg: fmt.Sprintf(
+					"%s: error setting value %q for option %s",
+					e.pos, e.value, e.name),
+				Wrapped:    err,
+				Suggestion: suggestionOf(err),
+			}
+		}
+	}
+	return nil
+}
+
+// findOption returns the option having the long name or nil.
+func findOption(options []*Option, name string) *Option {
+	for _, o := range options {
+		if o.hasName(name) {
+			return o
+		}
+	}
+	return nil
+}
+
+// readOptionLines reads the lines of an options file.
+func readOptionLines(r io.Reader, path string) (entries []fileEntry, err error) {
+	s := bufio.NewScanner(r)
+	for lineNo := 1; s.Scan(); lineNo++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		e := fileEntry{
+			pos:  fmt.Sprintf("%s:%d", path, lineNo),
+			name: line,
+		}
+		if i := strings.IndexByte(line, '='); i >= 0 {
+			e.name = strings.TrimSpace(line[:i])
+			e.value = strings.TrimSpace(line[i+1:])
+			e.hasValue = true
+		}
+		if strings.HasPrefix(e.value, `"`) {
+			if e.value, err = strconv.Unquote(e.value); err != nil {
+				return nil, &OptionError{
+					Option: e.name,
+					Msg: fmt.Sprintf(
+						"%s: malformed value for option %s",
+						e.pos, e.name),
+					Wrapped: err,
+				}
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, s.Err()
+}
+
+// readJSONOptions reads an options file containing a JSON object. The entries
+// are sorted by name.
+func readJSONOptions(r io.Reader, path string) (entries []fileEntry, err error) {
+	d := json.NewDecoder(r)
+	d.UseNumber()
+	var obj map[string]interface{}
+	if err = d.Decode(&obj); err != nil {
+		return nil, fmt.Errorf("cli: %s: %w", path, err)
+	}
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		values, ok := obj[name].([]interface{})
+		if !ok {
+			values = []interface{}{obj[name]}
+		}
+		for _, v := range values {
+			e := fileEntry{pos: path, name: name, hasValue: true}
+			switch v := v.(type) {
+			case nil:
+				continue
+			case string:
+				e.value = v
+			case json.Number:
+				e.value = v.String()
+			case bool:
+				e.value = strconv.FormatBool(v)
+			default:
+				return nil, &OptionError{
+					Option: name,
+					Msg: fmt.Sprintf(
+						"%s: unsupported value for option %s",
+						path, name),
+				}
+			}
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,395 @@
+// SPDX-FileCopyrightText: © 2021 Ulrich Kunitz
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/ulikunitz/cli"
+)
+
+func TestDefaultConfigPath(t *testing.T) {
+	switch runtime.GOOS {
+	case "windows", "darwin", "ios", "plan9":
+		t.Skip("XDG_CONFIG_HOME is not used on " + runtime.GOOS)
+	}
+	xdg, ok := os.LookupEnv("XDG_CONFIG_HOME")
+	os.Setenv("XDG_CONFIG_HOME", "/tmp/xdg")
+	defer func() {
+		if ok {
+			os.Setenv("XDG_CONFIG_HOME", xdg)
+		} else {
+			os.Unsetenv("XDG_CONFIG_HOME")
+		}
+	}()
+
+	const want = "/tmp/xdg/foo/config.json"
+	if p := cli.DefaultConfigPath("foo"); p != want {
+		t.Fatalf("DefaultConfigPath(%q) = %q; want %q", "foo", p, want)
+	}
+}
+
+func TestLoadOptionsFile(t *testing.T) {
+	var (
+		verbose bool
+		name    string
+		n       int
+	)
+	options := []*cli.Option{
+		cli.BoolOption(&verbose, "verbose", 'v', ""),
+		cli.StringOption(&name, "name", 0, ""),
+		cli.IntOption(&n, "num", 'n', ""),
+	}
+	path := filepath.Join(t.TempDir(), "foo.conf")
+	const conf = `# comment
+verbose
+
+name = "hello, world"
+num=0x10
+`
+	if err := os.WriteFile(path, []byte(conf), 0644); err != nil {
+		t.Fatalf("WriteFile error %s", err)
+	}
+	if err := cli.LoadOptionsFile(options, path); err != nil {
+		t.Fatalf("LoadOptionsFile error %s", err)
+	}
+	if !verbose || name != "hello, world" || n != 16 {
+		t.Fatalf("got verbose=%t name=%q num=%d", verbose, name, n)
+	}
+
+	for _, tc := range []struct {
+		conf string
+		msg  string
+	}{
+		{"verbose\nbogus = 1\n", "foo.conf:2: unknown option bogus"},
+		{"\nnum\n", "foo.conf:2: option num requires a value"},
+		{"num = x\n", "foo.conf:1: error setting value"},
+	} {
+		if err := os.WriteFile(path, []byte(tc.conf), 0644); err != nil {
+			t.Fatalf("WriteFile error %s", err)
+		}
+		// Options set by the previous file would be skipped.
+		if err := cli.ResetOptions(options); err != nil {
+			t.Fatalf("ResetOptions error %s", err)
+		}
+		err := cli.LoadOptionsFile(options, path)
+		var oe *cli.OptionError
+		if !errors.As(err, &oe) || !strings.Contains(err.Error(), tc.msg) {
+			t.Errorf("LoadOptionsFile(%q) error %v; want %q",
+				tc.conf, err, tc.msg)
+		}
+	}
+}
+
+func TestLoadOptionsFileTransform(t *testing.T) {
+	var level string
+	opt := cli.StringOption(&level, "level", 0, "")
+	opt.Transform = strings.ToLower
+	path := filepath.Join(t.TempDir(), "foo.conf")
+	if err := os.WriteFile(path, []byte("level = WARN\n"), 0644); err != nil {
+		t.Fatalf("WriteFile error %s", err)
+	}
+	if err := cli.LoadOptionsFile([]*cli.Option{opt}, path); err != nil {
+		t.Fatalf("LoadOptionsFile error %s", err)
+	}
+	if level != "warn" {
+		t.Fatalf("level is %q; want %q", level, "warn")
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	var (
+		dbURL   string
+		port    int
+		verbose bool
+	)
+	urlOpt := cli.StringOption(&dbURL, "db-url", 0, "database URL")
+	urlOpt.EnvVar = "CLI_TEST_DB_URL"
+	portOpt := cli.IntOption(&port, "port", 'p', "port")
+	portOpt.EnvVar = "CLI_TEST_PORT"
+	verboseOpt := cli.BoolOption(&verbose, "verbose", 'v', "verbose")
+	verboseOpt.EnvVar = "CLI_TEST_VERBOSE"
+	options := []*cli.Option{urlOpt, portOpt, verboseOpt}
+
+	env := map[string]string{
+		"CLI_TEST_DB_URL":  "postgres://env",
+		"CLI_TEST_PORT":    "8080",
+		"CLI_TEST_VERBOSE": "yes",
+	}
+	for name, value := range env {
+		os.Setenv(name, value)
+		defer os.Unsetenv(name)
+	}
+
+	_, err := cli.ParseOptions(options,
+		[]string{"--db-url", "postgres://cmdline"})
+	if err != nil {
+		t.Fatalf("ParseOptions error %s", err)
+	}
+	if err = cli.ApplyEnv(options); err != nil {
+		t.Fatalf("ApplyEnv error %s", err)
+	}
+	if dbURL != "postgres://cmdline" {
+		t.Errorf("db-url is %q; want the command line value", dbURL)
+	}
+	if port != 8080 {
+		t.Errorf("port is %d; want %d", port, 8080)
+	}
+	if !verbose {
+		t.Errorf("verbose is false; want true")
+	}
+
+	if err = cli.ResetOptions(options); err != nil {
+		t.Fatalf("ResetOptions error %s", err)
+	}
+	os.Setenv("CLI_TEST_PORT", "http")
+	err = cli.ApplyEnv(options)
+	if !errors.Is(err, &cli.OptionError{Option: "port"}) {
+		t.Fatalf("ApplyEnv error %v; want error for port", err)
+	}
+	if !strings.Contains(err.Error(), "$CLI_TEST_PORT") {
+		t.Fatalf("ApplyEnv error %q doesn't name the variable", err)
+	}
+	if dbURL != "postgres://env" {
+		t.Errorf("db-url is %q; want the environment value", dbURL)
+	}
+}
+
+func TestLoadOptionsFileRequired(t *testing.T) {
+	var name, host string
+	nameOpt := cli.StringOption(&name, "name", 0, "")
+	nameOpt.Required = true
+	hostOpt := cli.StringOption(&host, "host", 0, "")
+	options := []*cli.Option{nameOpt, hostOpt}
+	path := filepath.Join(t.TempDir(), "foo.conf")
+	const conf = "name = file\nhost = file\n"
+	if err := os.WriteFile(path, []byte(conf), 0644); err != nil {
+		t.Fatalf("WriteFile error %s", err)
+	}
+
+	_, err := cli.ParseOptions(options, []string{"--host", "cmdline"},
+		cli.SkipRequired)
+	if err != nil {
+		t.Fatalf("ParseOptions error %s", err)
+	}
+	if err = cli.LoadOptionsFile(options, path); err != nil {
+		t.Fatalf("LoadOptionsFile error %s", err)
+	}
+	if err = cli.CheckRequired(options); err != nil {
+		t.Fatalf("CheckRequired error %s", err)
+	}
+	if name != "file" {
+		t.Errorf("name is %q; want %q", name, "file")
+	}
+	if host != "cmdline" {
+		t.Errorf("host is %q; want the command line value", host)
+	}
+
+	if _, err = cli.ParseOptions(options, nil, cli.SkipRequired); err != nil {
+		t.Fatalf("ParseOptions error %s", err)
+	}
+	err = cli.CheckRequired(options)
+	if !errors.Is(err, &cli.OptionError{Option: "name"}) {
+		t.Fatalf("CheckRequired error %v; want error for name", err)
+	}
+	for _, tc := range []string{"n = x\n", "no-name = x\n"} {
+		if err = os.WriteFile(path, []byte(tc), 0644); err != nil {
+			t.Fatalf("WriteFile error %s", err)
+		}
+		err = cli.LoadOptionsFile(options, path)
+		if err == nil || !strings.Contains(err.Error(), "unknown option") {
+			t.Errorf("LoadOptionsFile(%q) error %v; want unknown option",
+				tc, err)
+		}
+	}
+}
+
+func TestApplyEnvAfterInvalidValue(t *testing.T) {
+	var port int
+	portOpt := cli.IntOption(&port, "port", 'p', "port")
+	portOpt.EnvVar = "CLI_TEST_PORT"
+	portOpt.Required = true
+	options := []*cli.Option{portOpt}
+	os.Setenv("CLI_TEST_PORT", "8080")
+	defer os.Unsetenv("CLI_TEST_PORT")
+
+	_, err := cli.ParseOptions(options, []string{"--port=http"},
+		cli.SkipRequired)
+	if err == nil {
+		t.Fatalf("ParseOptions returned no error")
+	}
+	if err = cli.CheckRequired(options); err == nil {
+		t.Fatalf("CheckRequired accepted the invalid value")
+	}
+	if err = cli.ApplyEnv(options); err != nil {
+		t.Fatalf("ApplyEnv error %s", err)
+	}
+	if port != 8080 {
+		t.Errorf("port is %d; want %d", port, 8080)
+	}
+}
+
+func TestApplyEnvEmpty(t *testing.T) {
+	var (
+		debug bool
+		name  = "default"
+	)
+	debugOpt := cli.BoolOption(&debug, "debug", 0, "")
+	debugOpt.EnvVar = "CLI_TEST_DEBUG"
+	nameOpt := cli.StringOption(&name, "name", 0, "")
+	nameOpt.EnvVar = "CLI_TEST_NAME"
+	os.Setenv("CLI_TEST_DEBUG", "")
+	defer os.Unsetenv("CLI_TEST_DEBUG")
+	os.Setenv("CLI_TEST_NAME", "")
+	defer os.Unsetenv("CLI_TEST_NAME")
+
+	if err := cli.ApplyEnv([]*cli.Option{debugOpt, nameOpt}); err != nil {
+		t.Fatalf("ApplyEnv error %s", err)
+	}
+	if debug {
+		t.Errorf("debug is true; want false for an empty variable")
+	}
+	if name != "" {
+		t.Errorf("name is %q; want the empty parameter", name)
+	}
+}
+
+func TestRunRequiredEnv(t *testing.T) {
+	var dbURL, got string
+	urlOpt := cli.StringOption(&dbURL, "db-url", 0, "database URL")
+	urlOpt.EnvVar = "CLI_TEST_DB_URL"
+	urlOpt.Required = true
+	root := &cli.Command{
+		Name:    "foo",
+		Options: []*cli.Option{urlOpt},
+		Exec: func(args []string) error {
+			got = dbURL
+			return nil
+		},
+	}
+	os.Setenv("CLI_TEST_DB_URL", "postgres://env")
+	defer os.Unsetenv("CLI_TEST_DB_URL")
+
+	if err := cli.Run(root, nil); err != nil {
+		t.Fatalf("Run error %s", err)
+	}
+	if got != "postgres://env" {
+		t.Errorf("db-url is %q; want the environment value", got)
+	}
+	err := cli.Run(root, []string{"--db-url", "postgres://cmdline"})
+	if err != nil {
+		t.Fatalf("Run error %s", err)
+	}
+	if got != "postgres://cmdline" {
+		t.Errorf("db-url is %q; want the command line value", got)
+	}
+
+	os.Unsetenv("CLI_TEST_DB_URL")
+	if _, _, err = cli.Parse(root, nil); !errors.Is(err,
+		&cli.OptionError{Option: "db-url"}) {
+		t.Fatalf("Parse error %v; want error for db-url", err)
+	}
+}
+
+func TestRunDefaultConfig(t *testing.T) {
+	switch runtime.GOOS {
+	case "windows", "darwin", "ios", "plan9":
+		t.Skip("XDG_CONFIG_HOME is not used on " + runtime.GOOS)
+	}
+	dir := t.TempDir()
+	xdg, ok := os.LookupEnv("XDG_CONFIG_HOME")
+	os.Setenv("XDG_CONFIG_HOME", dir)
+	defer func() {
+		if ok {
+			os.Setenv("XDG_CONFIG_HOME", xdg)
+		} else {
+			os.Unsetenv("XDG_CONFIG_HOME")
+		}
+	}()
+	if err := os.Mkdir(filepath.Join(dir, "foo"), 0755); err != nil {
+		t.Fatalf("Mkdir error %s", err)
+	}
+	const conf = `{
+  "cmdline": "file", "env": "file", "file": "file",
+  "verbose": true, "tags": ["a", "b"], "force": true
+}`
+	path := filepath.Join(dir, "foo", "config.json")
+	if err := os.WriteFile(path, []byte(conf), 0644); err != nil {
+		t.Fatalf("WriteFile error %s", err)
+	}
+	os.Setenv("CLI_TEST_CMDLINE", "env")
+	defer os.Unsetenv("CLI_TEST_CMDLINE")
+	os.Setenv("CLI_TEST_ENV", "env")
+	defer os.Unsetenv("CLI_TEST_ENV")
+
+	var (
+		cmdline, env, file, config string
+		verbose, force             bool
+		tags                       []string
+	)
+	cmdlineOpt := cli.StringOption(&cmdline, "cmdline", 0, "")
+	cmdlineOpt.EnvVar = "CLI_TEST_CMDLINE"
+	envOpt := cli.StringOption(&env, "env", 0, "")
+	envOpt.EnvVar = "CLI_TEST_ENV"
+	fileOpt := cli.StringOption(&file, "file", 0, "")
+	fileOpt.EnvVar = "CLI_TEST_FILE"
+	fileOpt.Required = true
+	root := &cli.Command{
+		Name:          "foo",
+		DefaultConfig: true,
+		PersistentOptions: []*cli.Option{
+			cli.PathOption(&config, "config", 0, "config file"),
+			cli.BoolOption(&verbose, "verbose", 'v', ""),
+			cli.StringSliceOption(&tags, "tags", 0, ""),
+		},
+		Subcommands: []*cli.Command{
+			{
+				Name:    "run",
+				Options: []*cli.Option{cmdlineOpt, envOpt, fileOpt},
+				Exec:    func(args []string) error { return nil },
+			},
+			{
+				Name: "delete",
+				Options: []*cli.Option{
+					cli.BoolOption(&force, "force", 'f', ""),
+				},
+				Exec: func(args []string) error { return nil },
+			},
+		},
+	}
+
+	if err := cli.Run(root, []string{"run", "--cmdline", "cmdline"}); err != nil {
+		t.Fatalf("Run error %s", err)
+	}
+	if cmdline != "cmdline" || env != "env" || file != "file" {
+		t.Errorf("got cmdline=%q env=%q file=%q;"+
+			" want cmdline, env and file", cmdline, env, file)
+	}
+	if !verbose || strings.Join(tags, ",") != "a,b" {
+		t.Errorf("got verbose=%t tags=%q; want true and [a b]",
+			verbose, tags)
+	}
+	if force {
+		t.Errorf("force of command delete has been set")
+	}
+
+	err := cli.Run(root, []string{"--config", "other.json", "run"})
+	if !errors.Is(err, &cli.OptionError{Option: "file"}) {
+		t.Fatalf("Run with --config error %v; want error for file", err)
+	}
+
+	if err = os.WriteFile(path, []byte(`{"bogus": 1}`), 0644); err != nil {
+		t.Fatalf("WriteFile error %s", err)
+	}
+	err = cli.Run(root, []string{"run", "--file", "x"})
+	if err == nil || !strings.Contains(err.Error(), "unknown option bogus") {
+		t.Fatalf("Run error %v; want unknown option bogus", err)
+	}
+}
@@ -0,0 +1,116 @@
+// SPDX-FileCopyrightText: © 2021 Ulrich Kunitz
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// AddDebugCommand adds the hidden subcommand __debug to the root command if it
+// doesn't exist already. The command prints the current values of all options
+// in the command tree together with their sources, which are default, command
+// line, environment, prompt or the options file. The values of secret options
+// are masked. The environment variables used by the options and required by
+// the commands are reported as set or unset without their values; those of
+// options with HideEnvVar set are omitted. Options of the root command can be
+// given before __debug, so the output reflects the effective configuration.
+func AddDebugCommand(root *Command) bool {
+	if _, ok := findCommand(root.Subcommands, "__debug"); ok {
+		return false
+	}
+	cmd := &Command{
+		Name:   "__debug",
+		Info:   "prints the configuration for bug reports",
+		Hidden: true,
+		Exec: func(args []string) error {
+			return writeDebug(root.output(), root)
+		},
+	}
+	root.Subcommands = append(root.Subcommands, cmd)
+	return true
+}
+
+// writeDebug writes the option values of cmd and its subcommands to w.
+func writeDebug(w io.Writer, root *Command) error {
+	var env []string
+	var walk func(cmd *Command, path string) error
+	walk = func(cmd *Command, path string) error {
+		if options := cmd.localOptions(); len(options) > 0 {
+			if _, err := fmt.Fprintf(w, "%s\n", path); err != nil {
+				return err
+			}
+			for _, o := range options {
+				name := o.Name
+				if name == "" {
+					name = string(o.Short)
+				}
+				value := debugValue(o.Value())
+				if o.Secret {
+					value = "(secret)"
+				}
+				source := o.source
+				if source == "" {
+					source = "default"
+				}
+				_, err := fmt.Fprintf(w, "    %s = %s (%s)\n",
+					o.dashName(name), value, source)
+				if err != nil {
+					return err
+				}
+				if o.EnvVar != "" && !o.HideEnvVar {
+					env = append(env, o.EnvVar)
+				}
+			}
+		}
+		env = append(env, cmd.RequiredEnv...)
+		cmd.loadSubcommands()
+		for _, c := range cmd.Subcommands {
+			if c.Hidden {
+				continue
+			}
+			if err := walk(c, path+" "+c.Name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(root, root.Name); err != nil {
+		return err
+	}
+	if len(env) == 0 {
+		return nil
+	}
+	if _, err := fmt.Fprintf(w, "environment\n"); err != nil {
+		return err
+	}
+	seen := make(map[string]bool, len(env))
+	for _, name := range env {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		s := "unset"
+		if _, ok := os.LookupEnv(name); ok {
+			s = "set"
+		}
+		if _, err := fmt.Fprintf(w, "    %s %s\n", name, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// debugValue formats an option value for the output of the debug command.
+func debugValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "(unknown)"
+	case string:
+		return fmt.Sprintf("%q", v)
+	}
+	return fmt.Sprint(v)
+}
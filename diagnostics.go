@@ -0,0 +1,96 @@
+// SPDX-FileCopyrightText: © 2021 Ulrich Kunitz
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Severity classifies a diagnostic.
+type Severity int
+
+// Severities of diagnostics
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityError
+)
+
+// String returns the lower-case name of the severity.
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	}
+	return fmt.Sprintf("severity(%d)", int(s))
+}
+
+// Diagnostic is a single entry collected by Diagnostics.
+type Diagnostic struct {
+	Severity Severity
+	// Command is the name of the command that parsed the option.
+	Command string
+	// Option is the option name as given in the arguments including the
+	// leading dashes. It is empty if the entry doesn't refer to an option.
+	Option  string
+	Message string
+}
+
+// String returns the diagnostic in the format used for printed warnings, e.g.
+// "warning: option --old is deprecated; use --new".
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s", d.Severity, d.Message)
+}
+
+// Diagnostics collects warnings and other diagnostics. If the Diagnostics
+// field of the root command is set, Parse and Run append the deprecation
+// warnings for options to it instead of printing them. ParseOptions still
+// prints them. The collector can be used by multiple goroutines.
+type Diagnostics struct {
+	mutex   sync.Mutex
+	entries []Diagnostic
+}
+
+// Add appends a diagnostic.
+func (d *Diagnostics) Add(diag Diagnostic) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.entries = append(d.entries, diag)
+}
+
+// Entries returns a copy of the diagnostics collected in the order they have
+// been added.
+func (d *Diagnostics) Entries() []Diagnostic {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	entries := make([]Diagnostic, len(d.entries))
+	copy(entries, d.entries)
+	return entries
+}
+
+// Reset removes all diagnostics.
+func (d *Diagnostics) Reset() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.entries = nil
+}
+
+// WriteTo writes the diagnostics to w, one line per entry.
+func (d *Diagnostics) WriteTo(w io.Writer) (n int64, err error) {
+	var sb strings.Builder
+	for _, diag := range d.Entries() {
+		sb.WriteString(diag.String())
+		sb.WriteByte('\n')
+	}
+	k, err := io.WriteString(w, sb.String())
+	return int64(k), err
+}
@@ -0,0 +1,65 @@
+// SPDX-FileCopyrightText: © 2021 Ulrich Kunitz
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ulikunitz/cli"
+)
+
+func TestDiagnostics(t *testing.T) {
+	var old, verbose bool
+	oldOpt := cli.BoolOption(&old, "old", 'o', "old option")
+	oldOpt.Deprecated = "use --new instead"
+	root := &cli.Command{
+		Name:        "foo",
+		Options:     []*cli.Option{cli.BoolOption(&verbose, "verbose", 'v', "")},
+		Diagnostics: &cli.Diagnostics{},
+		Subcommands: []*cli.Command{
+			{
+				Name:    "bar",
+				Options: []*cli.Option{oldOpt},
+				Exec:    func(args []string) error { return nil },
+			},
+		},
+	}
+
+	var sb strings.Builder
+	code := cli.RunMain(root, []string{"-v", "bar", "--old", "-o"}, &sb)
+	if code != cli.ExitOK {
+		t.Fatalf("RunMain returned %d; want %d", code, cli.ExitOK)
+	}
+	entries := root.Diagnostics.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("got %d diagnostics; want %d", len(entries), 2)
+	}
+	want := cli.Diagnostic{
+		Severity: cli.SeverityWarning,
+		Command:  "bar",
+		Option:   "--old",
+		Message:  "option --old is deprecated; use --new instead",
+	}
+	if entries[0] != want {
+		t.Fatalf("got diagnostic %+v; want %+v", entries[0], want)
+	}
+	if entries[1].Option != "-o" {
+		t.Fatalf("got option %q; want %q", entries[1].Option, "-o")
+	}
+	const output = "warning: option --old is deprecated; use --new instead\n" +
+		"warning: option -o is deprecated; use --new instead\n"
+	if got := sb.String(); got != output {
+		t.Fatalf("RunMain output %q; want %q", got, output)
+	}
+
+	root.Diagnostics.Reset()
+	if _, _, err := cli.Parse(root, []string{"bar"}); err != nil {
+		t.Fatalf("Parse error %s", err)
+	}
+	if n := len(root.Diagnostics.Entries()); n != 0 {
+		t.Fatalf("got %d diagnostics after Reset; want %d", n, 0)
+	}
+}
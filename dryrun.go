@@ -0,0 +1,48 @@
+// SPDX-FileCopyrightText: © 2021 Ulrich Kunitz
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import "context"
+
+// dryRunKey is the context key for the flag of the dry-run option.
+type dryRunKey struct{}
+
+// AddDryRunOption adds the persistent option --dry-run or -n to the root
+// command and returns the flag set by it. The flag can be checked directly or
+// with DryRun from the context passed to ExecContext by RunContext. The short
+// option is omitted if the root command uses -n already. The function returns
+// nil if the root command has already an option named dry-run.
+func AddDryRunOption(root *Command) *bool {
+	short := 'n'
+	for _, o := range root.localOptions() {
+		if o.hasName("dry-run") {
+			return nil
+		}
+		if o.hasShortString("n") {
+			short = 0
+		}
+	}
+	root.dryRun = new(bool)
+	root.PersistentOptions = append(root.PersistentOptions,
+		BoolOption(root.dryRun, "dry-run", short,
+			"shows what would be done without doing it"))
+	return root.dryRun
+}
+
+// withDryRun returns a context carrying the dry-run flag of the root command.
+func withDryRun(ctx context.Context, root *Command) context.Context {
+	if root.dryRun == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, dryRunKey{}, root.dryRun)
+}
+
+// DryRun reports whether the option --dry-run added by AddDryRunOption has
+// been given. The context must be the one passed to ExecContext. DryRun
+// returns false for other contexts.
+func DryRun(ctx context.Context) bool {
+	f, ok := ctx.Value(dryRunKey{}).(*bool)
+	return ok && *f
+}
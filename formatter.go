@@ -7,15 +7,32 @@ package cli
 import (
 	"go/doc/comment"
 	"io"
+	"strings"
 )
 
-// formatText is an interface to the go doc formatter.
-func formatText(w io.Writer, s string, lineWidth int, indent string) (n int, err error) {
+// FormatText formats the text s with the go doc comment formatter. Lines have
+// a maximum length of lineWidth and are preceded by indent. Paragraphs are
+// wrapped and indented lines are copied verbatim.
+func FormatText(w io.Writer, s string, lineWidth int, indent string) (n int, err error) {
+	pr := &comment.Printer{
+		TextWidth:  lineWidth,
+		TextPrefix: indent,
+	}
+	return FormatTextWith(w, s, pr)
+}
+
+// FormatTextWith formats the text s like FormatText but uses the printer pr,
+// which gives control over all aspects of the text rendering, for instance
+// the code prefix or the rendering of doc links. A nil printer is the default
+// printer. CRLF and CR line endings are converted to LF before parsing.
+func FormatTextWith(w io.Writer, s string, pr *comment.Printer) (n int, err error) {
+	if pr == nil {
+		pr = new(comment.Printer)
+	}
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.ReplaceAll(s, "\r", "\n")
 	var p comment.Parser
 	doc := p.Parse(s)
-	var pr comment.Printer
-	pr.TextWidth = lineWidth
-	pr.TextPrefix = indent
 	t := pr.Text(doc)
 	return w.Write(t)
 }
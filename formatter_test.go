@@ -5,6 +5,7 @@
 package cli
 
 import (
+	"go/doc/comment"
 	"os"
 	"regexp"
 	"strings"
@@ -21,9 +22,9 @@ Hier beginnt der nächste Paragraph.
   x := 4
 `
 	var sb strings.Builder
-	_, err := formatText(&sb, s, 80, "    ")
+	_, err := FormatText(&sb, s, 80, "    ")
 	if err != nil {
-		t.Fatalf("formatText error %s", err)
+		t.Fatalf("FormatText error %s", err)
 	}
 	t.Logf("\n%s", sb.String())
 }
@@ -36,9 +37,9 @@ func TestFormatText2(t *testing.T) {
 
 	for _, tc := range tests {
 		var sb strings.Builder
-		_, err := formatText(&sb, tc, 80, "    ")
+		_, err := FormatText(&sb, tc, 80, "    ")
 		if err != nil {
-			t.Fatalf("formatText(&sb, %q, %d, %q) error %s",
+			t.Fatalf("FormatText(&sb, %q, %d, %q) error %s",
 				tc, 80, "    ", err)
 		}
 		t.Logf("\n%s", sb.String())
@@ -66,9 +67,9 @@ func TestFormatText3(t *testing.T) {
 	}
 	s := string(d)
 	var sb strings.Builder
-	_, err = formatText(&sb, s, 80, "    ")
+	_, err = FormatText(&sb, s, 80, "    ")
 	if err != nil {
-		t.Fatalf("formatText error %s", err)
+		t.Fatalf("FormatText error %s", err)
 	}
 	o := sb.String()
 
@@ -89,3 +90,41 @@ func TestFormatText3(t *testing.T) {
 		}
 	}
 }
+
+func TestFormatTextWith(t *testing.T) {
+	const s = "A paragraph.\n\n\tcode\n"
+	pr := &comment.Printer{
+		TextPrefix:     "> ",
+		TextCodePrefix: "| ",
+	}
+	var sb strings.Builder
+	if _, err := FormatTextWith(&sb, s, pr); err != nil {
+		t.Fatalf("FormatTextWith error %s", err)
+	}
+	const want = "> A paragraph.\n>\n| code\n"
+	if got := sb.String(); got != want {
+		t.Fatalf("FormatTextWith returned %q; want %q", got, want)
+	}
+}
+
+func TestFormatTextCRLF(t *testing.T) {
+	d, err := os.ReadFile("testdata/description.txt")
+	if err != nil {
+		t.Fatalf("ReadFile error %s", err)
+	}
+	lf := string(d)
+	crlf := strings.ReplaceAll(lf, "\n", "\r\n")
+
+	var sb strings.Builder
+	if _, err = FormatText(&sb, lf, 80, "    "); err != nil {
+		t.Fatalf("FormatText error %s", err)
+	}
+	want := sb.String()
+	sb.Reset()
+	if _, err = FormatText(&sb, crlf, 80, "    "); err != nil {
+		t.Fatalf("FormatText error %s", err)
+	}
+	if got := sb.String(); got != want {
+		t.Fatalf("FormatText output for CRLF input differs:\n%s", got)
+	}
+}
@@ -5,43 +5,130 @@
 package cli
 
 import (
-	"os"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
 )
 
+// helpFormats maps the output formats supported by the help command to the
+// functions writing the documentation.
+var helpFormats = map[string]func(w io.Writer, cmd *Command) error{
+	"text": func(w io.Writer, cmd *Command) error {
+		_, err := cmd.WriteDoc(w)
+		return err
+	},
+	"markdown": WriteMarkdown,
+}
+
+func helpFormatNames() []string {
+	names := make([]string, 0, len(helpFormats))
+	for name := range helpFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// helpTopics separates the topics from the options in args. Options are
+// allowed before and after the topics.
+func helpTopics(options []*Option, args []string) (topics []string, err error) {
+	for len(args) > 0 {
+		k, err := ParseOptions(options, args)
+		if err != nil {
+			return nil, err
+		}
+		args = args[k:]
+		if len(args) > 0 {
+			topics = append(topics, args[0])
+			args = args[1:]
+		}
+	}
+	return topics, nil
+}
+
 // AddHelpCommand adds a subcommand help to the root command if doesn't support
-// a help command already.
+// a help command already. The help topics are resolved like the arguments of
+// Parse, so alternative names and unique prefixes of command names are
+// supported at every level, e.g. "help db mig" for "help database migrate".
+// Topics that don't match a command and ambiguous prefixes are reported as
+// errors. The help command supports the option --format to select the output
+// format. The default format is text.
 func AddHelpCommand(root *Command) bool {
-	for _, cmd := range root.Subcommands {
-		if cmd.Name == "help" {
-			return false
-		}
+	if _, ok := findCommand(root.Subcommands, "help"); ok {
+		return false
+	}
+
+	format := "text"
+	formats := helpFormatNames()
+	formatOpt := &Option{
+		Name: "format",
+		Description: "output format; supported formats are " +
+			strings.Join(formats, ", "),
+		HasParam:  true,
+		ParamType: strings.Join(formats, "|"),
+		Default:   format,
+		SetValue: func(name, arg string, noParam bool) error {
+			if _, ok := helpFormats[arg]; !ok {
+				return &OptionError{
+					Option:     name,
+					Msg:        fmt.Sprintf("unsupported format %q", arg),
+					Suggestion: suggest(arg, formats),
+				}
+			}
+			format = arg
+			return nil
+		},
 	}
+	options := []*Option{formatOpt}
 
+	var helpCmd *Command
 	f := func(args []string) error {
-		commands, _, err := Parse(root, args)
+		defer formatOpt.Reset()
+		topics, err := helpTopics(options, args)
 		if err != nil {
 			return err
 		}
+		commands, _, n, err := parse(root, topics, false)
+		if err != nil {
+			return err
+		}
+		if n < len(topics) {
+			return unrecognizedCommand(topics[n])
+		}
 		cmd := commands[len(commands)-1]
-		_, err = cmd.WriteDoc(os.Stdout)
-		return err
+		if err = helpFormats[format](helpCmd.output(), cmd); err != nil {
+			return err
+		}
+		return helpDone(root)
 	}
 
-	cmd := &Command{
-		Name:  "help",
-		Info:  "prints help messages",
-		Usage: root.Name + " help <commands>...",
-		Exec:  f,
+	helpCmd = &Command{
+		Name:    "help",
+		Info:    "prints help messages",
+		Usage:   root.Name + " help [--format <format>] <commands>...",
+		Options: options,
+		Exec:    f,
+		help:    true,
 	}
 
-	root.Subcommands = append(root.Subcommands, cmd)
+	root.Subcommands = append(root.Subcommands, helpCmd)
 
 	return true
 }
 
-var helpFlag = false
+// helpDone returns the error to be returned after the help has been printed.
+func helpDone(root *Command) error {
+	if root.HelpReturnsError {
+		return ErrHelpRequested
+	}
+	return nil
+}
 
-func helpOption() *Option {
+// helpOption returns the help option, which records its presence in *flag.
+func helpOption(flag *bool) *Option {
 	return &Option{
 		Name:        "help",
 		Short:       'h',
@@ -49,21 +136,27 @@ func helpOption() *Option {
 		HasParam:    false,
 		Default:     "",
 		SetValue: func(name, arg string, noParam bool) error {
-			helpFlag = true
+			*flag = true
 			return nil
 		},
-		ResetValue: func() { helpFlag = false },
+		ResetValue: func() { *flag = false },
+		help:       true,
 	}
 }
 
 // AddHelpOption adds a help option for the command if it doesn't have an option
-// -h already. Note the Exec function must already been set or the no help
-// option is added
+// -h already. Note the Exec, ExecContext or ExecCode function must already
+// been set or the command must have subcommands; otherwise no help option is
+// added. A command without such a function gets an Exec function that prints
+// the help if the option is given and reports the missing subcommand
+// otherwise. An ExecCode function returns ExitOK after printing the help, even
+// if HelpReturnsError is set.
 func AddHelpOption(cmd *Command) bool {
 	if cmd.Name == "help" {
 		return false
 	}
-	if cmd.Exec == nil {
+	if !cmd.hasExec() && len(cmd.Subcommands) == 0 &&
+		cmd.SubcommandProvider == nil {
 		return false
 	}
 	for _, o := range cmd.Options {
@@ -71,21 +164,55 @@ func AddHelpOption(cmd *Command) bool {
 			return false
 		}
 	}
-	f := cmd.Exec
-	newF := func(args []string) error {
-		if helpFlag {
-			_, err := cmd.WriteDoc(os.Stdout)
+	var helpFlag bool
+	printHelp := func() error {
+		if _, err := cmd.WriteDoc(cmd.output()); err != nil {
 			return err
 		}
-		return f(args)
+		return helpDone(cmd.rootCommand())
+	}
+	if g := cmd.ExecContext; g != nil {
+		cmd.ExecContext = func(ctx context.Context, args []string) error {
+			if helpFlag {
+				return printHelp()
+			}
+			return g(ctx, args)
+		}
+	}
+	if g := cmd.ExecCode; g != nil {
+		cmd.ExecCode = func(args []string) int {
+			if helpFlag {
+				err := printHelp()
+				if err != nil && !errors.Is(err, ErrHelpRequested) {
+					return ExitError
+				}
+				return ExitOK
+			}
+			return g(args)
+		}
+	}
+	f := cmd.Exec
+	if !cmd.hasExec() {
+		f = func(args []string) error {
+			return usageError{noExecError(cmd)}
+		}
+		cmd.helpOnly = true
+	}
+	if f != nil {
+		cmd.Exec = func(args []string) error {
+			if helpFlag {
+				return printHelp()
+			}
+			return f(args)
+		}
 	}
-	cmd.Options = append(cmd.Options, helpOption())
-	cmd.Exec = newF
+	cmd.Options = append(cmd.Options, helpOption(&helpFlag))
 	return true
 }
 
 // AddHelpOptionToAll adds a help option to all subcommands that don't have the
-// name help.
+// name help. Subcommands without Output field write the help to the Output of
+// their parent at the time the help is printed.
 func AddHelpOptionToAll(cmd *Command) {
 	AddHelpOption(cmd)
 	for _, c := range cmd.Subcommands {
@@ -0,0 +1,296 @@
+// SPDX-FileCopyrightText: © 2021 Ulrich Kunitz
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/ulikunitz/cli"
+)
+
+func TestAddHelpOptionSetValue(t *testing.T) {
+	cmd := &cli.Command{
+		Name: "foo",
+		Exec: func(args []string) error { return nil },
+	}
+	if !cli.AddHelpOption(cmd) {
+		t.Fatalf("AddHelpOption returned false")
+	}
+	opt := cmd.Options[len(cmd.Options)-1]
+	if opt.Name != "help" || opt.Short != 'h' {
+		t.Fatalf("added option %s/-%c; want help/-h", opt.Name, opt.Short)
+	}
+	var setValue func(name, param string, noParam bool) error = opt.SetValue
+	if err := setValue("help", "", true); err != nil {
+		t.Fatalf("SetValue error %s", err)
+	}
+	if err := opt.Reset(); err != nil {
+		t.Fatalf("Reset error %s", err)
+	}
+}
+
+func TestAddHelpOptionToAllGroups(t *testing.T) {
+	exec := func(args []string) error { return nil }
+	root := &cli.Command{
+		Name: "tool",
+		Subcommands: []*cli.Command{
+			{
+				Name: "rank",
+				Subcommands: []*cli.Command{
+					{
+						Name: "db",
+						Subcommands: []*cli.Command{
+							{Name: "show", Exec: exec},
+						},
+					},
+				},
+			},
+		},
+	}
+	cli.AddHelpCommand(root)
+	cli.AddHelpOptionToAll(root)
+
+	var check func(cmd *cli.Command)
+	check = func(cmd *cli.Command) {
+		if cmd.Name == "help" {
+			return
+		}
+		found := false
+		for _, o := range cmd.Options {
+			if o.Name == "help" {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("command %s has no help option", cmd.Name)
+		}
+		if cmd.Exec == nil {
+			t.Errorf("command %s has no Exec function", cmd.Name)
+		}
+		for _, c := range cmd.Subcommands {
+			check(c)
+		}
+	}
+	check(root)
+
+	var buf bytes.Buffer
+	root.Output = &buf
+	outputs := make(map[string]string)
+	for _, args := range [][]string{
+		{"rank", "-h"},
+		{"rank", "--help"},
+		{"help", "rank"},
+	} {
+		buf.Reset()
+		code, err := cli.RunCode(root, args)
+		if err != nil || code != cli.ExitOK {
+			t.Fatalf("RunCode(%q) returned %d, %v; want %d, nil",
+				args, code, err, cli.ExitOK)
+		}
+		outputs[strings.Join(args, " ")] = buf.String()
+	}
+	want := outputs["help rank"]
+	if !strings.Contains(want, "rank") || !strings.Contains(want, "db") {
+		t.Fatalf("help rank wrote %q", want)
+	}
+	for _, args := range []string{"rank -h", "rank --help"} {
+		if outputs[args] != want {
+			t.Errorf("%s wrote %q; want %q", args, outputs[args], want)
+		}
+	}
+}
+
+func TestHelpPartialTopics(t *testing.T) {
+	exec := func(args []string) error { return nil }
+	root := &cli.Command{
+		Name: "foo",
+		Subcommands: []*cli.Command{
+			{
+				Name: "database",
+				Subcommands: []*cli.Command{
+					{Name: "migrate", Info: "migrates the schema",
+						Exec: exec},
+					{Name: "mount", Info: "mounts the database",
+						Exec: exec},
+				},
+			},
+			{Name: "deploy", Info: "deploys the service", Exec: exec},
+		},
+	}
+	cli.AddHelpCommand(root)
+
+	for _, args := range [][]string{
+		{"help", "database", "migrate"},
+		{"help", "data", "mig"},
+		{"help", "da", "mi"},
+	} {
+		out, err := captureStdout(t, func() error {
+			return cli.Run(root, args)
+		})
+		if err != nil {
+			t.Fatalf("Run(%q) error %s", args, err)
+		}
+		if !strings.Contains(out, "migrate - migrates the schema") {
+			t.Errorf("Run(%q) output:\n%s", args, out)
+		}
+	}
+
+	tests := []struct {
+		args []string
+		msg  string
+	}{
+		{[]string{"help", "d", "mig"},
+			"ambiguous command d; candidates are database, deploy"},
+		{[]string{"help", "data", "m"},
+			"ambiguous command m; candidates are migrate, mount"},
+		{[]string{"help", "data", "bogus"}, "unrecognized command bogus"},
+	}
+	for _, tc := range tests {
+		_, err := captureStdout(t, func() error {
+			return cli.Run(root, tc.args)
+		})
+		if err == nil || !strings.Contains(err.Error(), tc.msg) {
+			t.Errorf("Run(%q) error %v; want %q", tc.args, err, tc.msg)
+		}
+	}
+}
+
+func TestHelpOptionPerCommand(t *testing.T) {
+	var executed []string
+	exec := func(name string) func(args []string) error {
+		return func(args []string) error {
+			executed = append(executed, name)
+			return nil
+		}
+	}
+	root := &cli.Command{
+		Name: "foo",
+		Subcommands: []*cli.Command{
+			{Name: "bar", Exec: exec("bar")},
+			{Name: "baz", Exec: exec("baz")},
+		},
+	}
+	cli.AddHelpOptionToAll(root)
+
+	commands, n, err := cli.Parse(root, []string{"bar", "-h"})
+	if err != nil {
+		t.Fatalf("Parse error %s", err)
+	}
+	if n != 2 {
+		t.Fatalf("Parse returned n=%d; want %d", n, 2)
+	}
+	bar := commands[len(commands)-1]
+	if bar.Name != "bar" {
+		t.Fatalf("Parse resolved command %s; want bar", bar.Name)
+	}
+
+	baz := root.Subcommands[1]
+	if err := baz.Exec(nil); err != nil {
+		t.Fatalf("baz.Exec error %s", err)
+	}
+	if len(executed) != 1 || executed[0] != "baz" {
+		t.Fatalf("executed %q; want [baz]", executed)
+	}
+
+	out, err := captureStdout(t, func() error { return bar.Exec(nil) })
+	if err != nil {
+		t.Fatalf("bar.Exec error %s", err)
+	}
+	if len(executed) != 1 {
+		t.Fatalf("bar executed despite -h: %q", executed)
+	}
+	if !strings.Contains(out, "bar") {
+		t.Fatalf("bar help output %q", out)
+	}
+}
+
+func TestHelpOutput(t *testing.T) {
+	exec := func(args []string) error { return nil }
+	var buf bytes.Buffer
+	root := &cli.Command{
+		Name: "foo",
+		Subcommands: []*cli.Command{
+			{
+				Name: "db",
+				Subcommands: []*cli.Command{
+					{Name: "migrate", Info: "migrates the schema",
+						Exec: exec},
+				},
+			},
+		},
+	}
+	cli.AddHelpCommand(root)
+	cli.AddHelpOptionToAll(root)
+	// The Output of the root is used at the time the help is printed.
+	root.Output = &buf
+
+	for _, args := range [][]string{
+		{"help", "db", "migrate"},
+		{"db", "migrate", "-h"},
+	} {
+		buf.Reset()
+		out, err := captureStdout(t, func() error {
+			return cli.Run(root, args)
+		})
+		if err != nil {
+			t.Fatalf("Run(%q) error %s", args, err)
+		}
+		if out != "" {
+			t.Errorf("Run(%q) wrote %q to stdout", args, out)
+		}
+		if !strings.Contains(buf.String(), "migrates the schema") {
+			t.Errorf("Run(%q) wrote %q to Output", args, buf.String())
+		}
+	}
+}
+
+func TestHelpOptionExecCode(t *testing.T) {
+	var buf bytes.Buffer
+	var got []string
+	execCode := func(args []string) int {
+		got = args
+		return 3
+	}
+	codeOnly := &cli.Command{
+		Name:     "code",
+		Info:     "returns a code",
+		Output:   &buf,
+		ExecCode: execCode,
+	}
+	both := &cli.Command{
+		Name:     "both",
+		Info:     "has Exec and ExecCode",
+		Output:   &buf,
+		Exec:     func(args []string) error { return nil },
+		ExecCode: execCode,
+	}
+	for _, cmd := range []*cli.Command{codeOnly, both} {
+		if !cli.AddHelpOption(cmd) {
+			t.Fatalf("AddHelpOption(%s) returned false", cmd.Name)
+		}
+		buf.Reset()
+		got = nil
+		code, err := cli.RunCode(cmd, []string{"-h"})
+		if err != nil || code != cli.ExitOK {
+			t.Fatalf("RunCode(%s, -h) returned %d, %v; want %d, nil",
+				cmd.Name, code, err, cli.ExitOK)
+		}
+		if got != nil {
+			t.Fatalf("RunCode(%s, -h) executed ExecCode with %q",
+				cmd.Name, got)
+		}
+		if !strings.Contains(buf.String(), cmd.Info) {
+			t.Fatalf("RunCode(%s, -h) printed %q; want help",
+				cmd.Name, buf.String())
+		}
+		code, err = cli.RunCode(cmd, []string{"a"})
+		if err != nil || code != 3 {
+			t.Fatalf("RunCode(%s, a) returned %d, %v; want 3, nil",
+				cmd.Name, code, err)
+		}
+	}
+}
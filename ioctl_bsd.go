@@ -10,3 +10,5 @@ package cli
 import "syscall"
 
 const ioctlGetTermios = syscall.TIOCGETA
+
+const ioctlSetTermios = syscall.TIOCSETA
@@ -5,3 +5,5 @@
 package cli
 
 const ioctlGetTermios = 0x5401 // syscall.TCGETS
+
+const ioctlSetTermios = 0x5402 // syscall.TCSETS
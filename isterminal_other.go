@@ -0,0 +1,19 @@
+// SPDX-FileCopyrightText: © 2021 Ulrich Kunitz
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !darwin && !dragonfly && !freebsd && (!linux || appengine) && !netbsd && !openbsd && !windows
+// +build !darwin
+// +build !dragonfly
+// +build !freebsd
+// +build !linux appengine
+// +build !netbsd
+// +build !openbsd
+// +build !windows
+
+package cli
+
+// IsTerminal returns false on platforms without terminal support.
+func IsTerminal(fd uintptr) bool {
+	return false
+}
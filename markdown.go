@@ -0,0 +1,119 @@
+// SPDX-FileCopyrightText: © 2021 Ulrich Kunitz
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// mdText returns the text on a single line. It is used for list items and
+// table cells, which cannot span multiple lines.
+func mdText(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// mdCell returns the text for a table cell with the pipe characters escaped.
+func mdCell(s string) string {
+	return strings.ReplaceAll(mdText(s), "|", `\|`)
+}
+
+// mdItem writes a list item with the code span and the description.
+func mdItem(sb *strings.Builder, code, description string) {
+	fmt.Fprintf(sb, "- `%s`", code)
+	if d := mdText(description); d != "" {
+		fmt.Fprintf(sb, ": %s", d)
+	}
+	sb.WriteByte('\n')
+}
+
+// WriteMarkdown writes the documentation of the command in Markdown to w. It
+// has the sections of WriteDoc as second-level headings. The usage is put into
+// a code block, the arguments and options are bullet lists and the
+// subcommands a table with their names and Info fields. The text is not
+// wrapped, since Markdown renderers reflow it.
+func WriteMarkdown(w io.Writer, cmd *Command) error {
+	cmd.loadSubcommands()
+	var sb strings.Builder
+	section := func(title string) {
+		if sb.Len() > 0 {
+			sb.WriteByte('\n')
+		}
+		fmt.Fprintf(&sb, "## %s\n\n", title)
+	}
+	if cmd.Name != "" || cmd.Info != "" {
+		section("NAME")
+		switch {
+		case cmd.Name != "" && cmd.Info != "":
+			fmt.Fprintf(&sb, "%s - %s\n", cmd.Name, mdText(cmd.Info))
+		case cmd.Name != "":
+			fmt.Fprintf(&sb, "%s\n", cmd.Name)
+		default:
+			fmt.Fprintf(&sb, "%s\n", mdText(cmd.Info))
+		}
+	}
+	usage := cmd.Usage
+	if usage == "" && len(cmd.PositionalArgs) > 0 {
+		usage = cmd.synopsis()
+	}
+	if usage != "" {
+		section("USAGE")
+		sb.WriteString("```\n")
+		for _, line := range strings.Split(usage, "\n") {
+			line = strings.TrimRight(line, " \t\r")
+			if line == "" {
+				continue
+			}
+			fmt.Fprintf(&sb, "%s\n", line)
+		}
+		sb.WriteString("```\n")
+	}
+	if d := strings.TrimSpace(cmd.Description); d != "" {
+		section("DESCRIPTION")
+		fmt.Fprintf(&sb, "%s\n", d)
+	}
+	if len(cmd.PositionalArgs) > 0 {
+		section("ARGUMENTS")
+		for i := range cmd.PositionalArgs {
+			spec := &cmd.PositionalArgs[i]
+			mdItem(&sb, spec.Usage(), spec.Description)
+		}
+	}
+	if options := visibleOptions(cmd.localOptions()); len(options) > 0 {
+		section("OPTIONS")
+		for _, o := range sortOptions(options) {
+			mdItem(&sb, o.Usage(), o.Description)
+		}
+	}
+	if options := visibleOptions(cmd.inheritedOptions()); len(options) > 0 {
+		section("GLOBAL OPTIONS")
+		for _, o := range sortOptions(options) {
+			mdItem(&sb, o.Usage(), o.Description)
+		}
+	}
+	if hasVisibleCommands(cmd.Subcommands) {
+		section("SUBCOMMANDS")
+		var commands []*Command
+		for _, c := range cmd.Subcommands {
+			if c.Name != "" && !c.Hidden {
+				commands = append(commands, c)
+			}
+		}
+		sort.SliceStable(commands, func(i, j int) bool {
+			return commands[i].Name < commands[j].Name
+		})
+		sb.WriteString("| Name | Description |\n")
+		sb.WriteString("| --- | --- |\n")
+		for _, c := range commands {
+			fmt.Fprintf(&sb, "| %s | %s |\n", mdCell(c.Name),
+				mdCell(c.Info))
+		}
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
@@ -0,0 +1,56 @@
+// SPDX-FileCopyrightText: © 2021 Ulrich Kunitz
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ulikunitz/cli"
+)
+
+func TestWriteMarkdown(t *testing.T) {
+	var verbose bool
+	var output string
+	exec := func(args []string) error { return nil }
+	root := &cli.Command{
+		Name:        "tool",
+		Info:        "manages things",
+		Usage:       "tool [options] <command>",
+		Description: "The tool manages things\nin various ways.",
+		Options: []*cli.Option{
+			cli.BoolOption(&verbose, "verbose", 'v', "prints more"),
+			cli.StringOption(&output, "output", 'o', "output file"),
+		},
+		Subcommands: []*cli.Command{
+			{Name: "export", Info: "exports a | b", Exec: exec},
+			{Name: "build", Info: "builds things", Exec: exec},
+			{Name: "internal", Hidden: true, Exec: exec},
+		},
+	}
+	var sb strings.Builder
+	if err := cli.WriteMarkdown(&sb, root); err != nil {
+		t.Fatalf("WriteMarkdown error %s", err)
+	}
+	doc := sb.String()
+	t.Logf("markdown:\n%s", doc)
+
+	for _, s := range []string{
+		"## NAME\n\ntool - manages things\n",
+		"## USAGE\n\n```\ntool [options] <command>\n```\n",
+		"## DESCRIPTION\n\nThe tool manages things\nin various ways.\n",
+		"## OPTIONS\n\n- `-o string, --output=string`: output file\n" +
+			"- `-v, --verbose`: prints more\n",
+		"## SUBCOMMANDS\n\n| Name | Description |\n| --- | --- |\n" +
+			"| build | builds things |\n| export | exports a \\| b |\n",
+	} {
+		if !strings.Contains(doc, s) {
+			t.Errorf("markdown doesn't contain %q", s)
+		}
+	}
+	if strings.Contains(doc, "internal") {
+		t.Errorf("markdown contains hidden command internal")
+	}
+}
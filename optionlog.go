@@ -0,0 +1,64 @@
+// SPDX-FileCopyrightText: © 2021 Ulrich Kunitz
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+// OptionEvent describes a single occurrence of an option.
+type OptionEvent struct {
+	Option *Option
+	// Name is the long name or the short name of the option as given in
+	// the arguments, without dashes.
+	Name string
+	// Param is the parameter after Transform and ValueAliases have been
+	// applied.
+	Param   string
+	NoParam bool
+}
+
+// OptionLog records the occurrences of options in the order they have been
+// parsed. It supports options whose relative order matters, e.g.
+//
+//	--define A --undef B --define C
+//
+// where the values of the options define and undef are stored separately.
+// Options are added to the log by Record. Resetting the options isn't
+// recorded.
+type OptionLog struct {
+	events []OptionEvent
+}
+
+// Record wraps the SetValue functions of the options, so that every
+// successful call is appended to the log. Options must not be recorded twice.
+func (l *OptionLog) Record(options ...*Option) {
+	for _, o := range options {
+		o := o
+		setValue := o.SetValue
+		o.SetValue = func(name, param string, noParam bool) error {
+			if err := setValue(name, param, noParam); err != nil {
+				return err
+			}
+			if name != resetName {
+				l.events = append(l.events, OptionEvent{
+					Option:  o,
+					Name:    name,
+					Param:   param,
+					NoParam: noParam,
+				})
+			}
+			return nil
+		}
+	}
+}
+
+// Events returns a copy of the events recorded.
+func (l *OptionLog) Events() []OptionEvent {
+	events := make([]OptionEvent, len(l.events))
+	copy(events, l.events)
+	return events
+}
+
+// Reset removes all events.
+func (l *OptionLog) Reset() {
+	l.events = nil
+}
@@ -5,12 +5,18 @@
 package cli
 
 import (
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"os"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // Option represents a single option.
@@ -31,16 +37,145 @@ type Option struct {
 	HasParam bool
 	// OptionalParam
 	OptionalParam bool
+	// Immediate options take effect when they are set and stop the
+	// parsing, e.g. --version printing the version in SetValue.
+	// ParseOptions and Parse return ErrImmediate after such an option has
+	// been set successfully, and Run returns without executing the command
+	// or checking the required options.
+	Immediate bool
+	// Negatable lets an option without parameter accept also the long names
+	// prefixed by no-, e.g. --no-color for --color. SetValue is then called
+	// with the parameter false. The short names are not affected.
+	Negatable bool
+	// Repeatable marks an option that may be given multiple times, for
+	// instance to collect values in a slice. The usage information appends
+	// "..." to it. The parser calls SetValue for every occurrence in the
+	// order of the arguments; an OptionLog records the order across
+	// different options.
+	Repeatable bool
+	// RequireEquals accepts a parameter for the long names of the option
+	// only in the form --name=value, so that a following argument is
+	// never consumed as parameter. Short options are not affected.
+	RequireEquals bool
 	// ParamType describes the type of the parameter
 	ParamType string
+	// Placeholder is shown for the parameter in the usage information
+	// instead of ParamType, e.g. FILE in --out=FILE.
+	Placeholder string
+	// ParamErrorMsg replaces the message "option --name requires a
+	// parameter" reported if the parameter is missing, e.g. "--since
+	// requires a date value".
+	ParamErrorMsg string
 	// Default param value.
 	Default string
+	// HideDefault omits the default from the usage information. The
+	// default is still applied.
+	HideDefault bool
+	// Secret marks an option whose value must not be shown, e.g. a
+	// password. The usage information omits its default and the __debug
+	// command masks its value. PromptMissing reads it with the echo of
+	// the terminal disabled.
+	Secret bool
+	// DefaultTemplate is a text/template producing the default value, e.g.
+	// {{.Home}}/.foo/log. It is executed with a TemplateContext by Reset and
+	// ResetOptions and, if the option hasn't been given, after ParseOptions,
+	// Parse and Run parsed the arguments. The option is set to the result.
+	// The usage information shows the result if Default is empty.
+	DefaultTemplate string
+	// EnvVar is the name of the environment variable associated with the
+	// option. The usage information mentions it as [$NAME]. ApplyEnv sets
+	// the option from the variable if it hasn't been given; Parse and Run
+	// call it before they check the required options.
+	EnvVar string
+	// HideEnvVar suppresses the environment variable in the usage
+	// information, which is useful for internal variables.
+	HideEnvVar bool
+	// Experimental options can only be used if the environment variable
+	// named by ExperimentalEnv is set to true. Otherwise the parser
+	// reports an error and the usage information omits the option.
+	Experimental bool
+	// Required options must be given. The default value doesn't satisfy
+	// the requirement. Parse checks the required options of the command
+	// selected and the persistent options of its ancestors. Only the
+	// arguments of the current call count; Parse and ParseOptions forget
+	// earlier settings.
+	Required bool
+	// Deprecated marks the option as deprecated if not empty. The string
+	// should advise the user what to use instead and is printed as
+	// warning, once per process, if the option is used.
+	Deprecated string
+	// Transform rewrites a parameter before it is passed to SetValue, for
+	// instance to normalize case or to expand ~ in paths. It is applied to
+	// parameters from the command line and from options files and not
+	// called if the option is used without parameter.
+	Transform func(param string) string
+	// ValueAliases maps alternative spellings of parameters to the
+	// canonical values passed to SetValue, e.g. "warn" to "warning". The
+	// mapping is applied after Transform. The usage information doesn't
+	// show the aliases.
+	ValueAliases map[string]string
 	// SetValue set the value to the parameter string given and informs
 	// whether there was a parameter or not.
 	SetValue func(name string, param string, noParam bool) error
 	// ResetValue can be used to reset the value. If it is nil then
-	// opt.SetValue(opt.Default, false) will be called.
+	// opt.SetValue(opt.Default, false) will be called. Options whose
+	// initial state cannot be reconstructed from Default, for instance
+	// slices or maps, must provide ResetValue. All constructors of this
+	// package set it.
 	ResetValue func()
+	// GetValue returns the current value of the option. The constructors
+	// of this package set it to a function returning the value pointed
+	// to, e.g. a bool for BoolOption.
+	GetValue func() interface{}
+
+	// seen records that the value has been set since the last reset or
+	// the start of the last parse.
+	seen bool
+	// source describes where the current value came from, e.g. "command
+	// line". It is empty for the default.
+	source string
+	// help marks the help option. Required options are not checked if it
+	// has been given.
+	help bool
+	// choices are the values allowed by an EnumOption.
+	choices []string
+}
+
+// Value returns the current value of the option or nil if GetValue is not
+// defined.
+func (opt *Option) Value() interface{} {
+	if opt.GetValue == nil {
+		return nil
+	}
+	return opt.GetValue()
+}
+
+// BoolValue returns the value of an option created by BoolOption. The value ok
+// is false for other options.
+func (opt *Option) BoolValue() (b bool, ok bool) {
+	b, ok = opt.Value().(bool)
+	return b, ok
+}
+
+// StringValue returns the value of an option created by StringOption. The
+// value ok is false for other options.
+func (opt *Option) StringValue() (s string, ok bool) {
+	s, ok = opt.Value().(string)
+	return s, ok
+}
+
+// IntValue returns the value of an option created by IntOption. The value ok
+// is false for other options.
+func (opt *Option) IntValue() (n int, ok bool) {
+	n, ok = opt.Value().(int)
+	return n, ok
+}
+
+// Float64Value returns the value of an option created by Float64Option. The
+// value ok is false for other options.
+func (opt *Option) Float64Value() (x float64, ok bool) {
+	x, ok = opt.Value().(float64)
+	return x, ok
 }
 
 // AllShorts returns all short option names in lexicographic order.
@@ -130,7 +265,19 @@ func validShort(s rune) {
 const resetName = "<reset>"
 
 // Reset calls ResetValue if defined or SetValue with with the default argument.
+// The default template is applied afterwards; it can't refer to the values of
+// other options.
 func (opt *Option) Reset() error {
+	if err := opt.reset(); err != nil {
+		return err
+	}
+	return opt.applyDefaultTemplate(newTemplateContext(nil))
+}
+
+// reset resets the option without applying the default template.
+func (opt *Option) reset() error {
+	opt.seen = false
+	opt.source = ""
 	if opt.ResetValue != nil {
 		opt.ResetValue()
 		return nil
@@ -138,7 +285,38 @@ func (opt *Option) Reset() error {
 	return opt.SetValue(resetName, opt.Default, false)
 }
 
+// clearSeen forgets that the option has been set, so that a new parse checks
+// the required options again. The help option also clears its flag.
+func (opt *Option) clearSeen() {
+	opt.seen = false
+	if opt.help && opt.ResetValue != nil {
+		opt.ResetValue()
+	}
+}
+
+// clearSeenOptions calls clearSeen for all options.
+func clearSeenOptions(options []*Option) {
+	for _, o := range options {
+		o.clearSeen()
+	}
+}
+
+// parseBool extends strconv.ParseBool by the values yes, no, on and off.
+func parseBool(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "yes", "on":
+		return true, nil
+	case "no", "off":
+		return false, nil
+	}
+	return strconv.ParseBool(s)
+}
+
 // BoolOption initializes a boolean flag. The argument f will be set to false.
+// The flag is set to true if SetValue is called without a parameter, which is
+// the case on the command line. A parameter, as provided for instance by an
+// environment variable, is interpreted by strconv.ParseBool, which is extended
+// by the values yes, no, on and off.
 func BoolOption(f *bool, name string, short rune, description string) *Option {
 	validShort(short)
 	*f = false
@@ -149,10 +327,118 @@ func BoolOption(f *bool, name string, short rune, description string) *Option {
 		HasParam:    false,
 		Default:     "",
 		SetValue: func(name, arg string, noParam bool) error {
-			*f = true
+			if noParam {
+				*f = true
+				return nil
+			}
+			b, err := parseBool(arg)
+			if err != nil {
+				return err
+			}
+			*f = b
 			return nil
 		},
 		ResetValue: func() { *f = false },
+		GetValue:   func() interface{} { return *f },
+	}
+}
+
+// isBool reports whether the option is a boolean flag, whose value is a bool.
+func (opt *Option) isBool() bool {
+	_, ok := opt.BoolValue()
+	return !opt.HasParam && ok
+}
+
+// NegatableBoolOption creates a boolean flag like BoolOption, whose long names
+// can be negated by the prefix no-, e.g. --color sets f to true and --no-color
+// to false.
+func NegatableBoolOption(f *bool, name string, short rune, description string) *Option {
+	opt := BoolOption(f, name, short, description)
+	opt.Negatable = true
+	return opt
+}
+
+// CountOption creates a flag that counts how often it is used, e.g. -vvv sets
+// n to 3. The argument n will be set to zero. A parameter, as provided for
+// instance by an environment variable, sets the count directly.
+func CountOption(n *int, name string, short rune, description string) *Option {
+	validShort(short)
+	*n = 0
+	return &Option{
+		Name:        name,
+		Short:       short,
+		Description: description,
+		HasParam:    false,
+		Default:     "",
+		SetValue: func(name, arg string, noParam bool) error {
+			if noParam {
+				*n++
+				return nil
+			}
+			k, err := strconv.Atoi(arg)
+			if err != nil {
+				return err
+			}
+			*n = k
+			return nil
+		},
+		ResetValue: func() { *n = 0 },
+		GetValue:   func() interface{} { return *n },
+	}
+}
+
+// BoolGroupOption creates a flag that sets all member options to value, e.g.
+// --disable-all setting a list of feature flags to false. The parameter false,
+// e.g. from an options file, sets the members to the negation of value. The
+// members must be boolean flags like the flags created by BoolOption; the
+// function panics if a member doesn't satisfy this condition. The members are
+// marked as set like options given on the command line, so they are not
+// overridden by ApplyEnv. Options following the group option on the command
+// line override the group setting.
+func BoolGroupOption(name string, short rune, value bool, members []*Option, description string) *Option {
+	validShort(short)
+	if len(members) == 0 {
+		panic(fmt.Errorf("cli: bool group %q has no members", name))
+	}
+	for _, m := range members {
+		if m.SetValue == nil || !m.isBool() {
+			panic(fmt.Errorf(
+				"cli: member %q of bool group %q is not a boolean flag",
+				m.Name, name))
+		}
+	}
+	source := "option --" + name
+	if name == "" {
+		source = "option -" + string(short)
+	}
+	return &Option{
+		Name:        name,
+		Short:       short,
+		Description: description,
+		HasParam:    false,
+		Default:     "",
+		SetValue: func(name, arg string, noParam bool) error {
+			v := value
+			if !noParam {
+				b, err := parseBool(arg)
+				if err != nil {
+					return err
+				}
+				v = b == value
+			}
+			param := strconv.FormatBool(v)
+			for _, m := range members {
+				n := m.Name
+				if n == "" {
+					n = string(m.Short)
+				}
+				if err := m.set(source, n, param, false); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		ResetValue: func() {},
 	}
 }
 
@@ -160,6 +446,7 @@ func BoolOption(f *bool, name string, short rune, description string) *Option {
 // when Parse is called.
 func StringOption(s *string, name string, short rune, description string) *Option {
 	validShort(short)
+	initial := *s
 	return &Option{
 		Name:        name,
 		Short:       short,
@@ -171,7 +458,72 @@ func StringOption(s *string, name string, short rune, description string) *Optio
 			*s = arg
 			return nil
 		},
+		ResetValue: func() { *s = initial },
+		GetValue:   func() interface{} { return *s },
+	}
+}
+
+// EnumOption creates a string flag that accepts only the values in allowed. The
+// usage information shows the choices, e.g. --format=(json|yaml|text). The
+// default value is the value that s has when the function is called. The
+// function panics if allowed is empty.
+func EnumOption(s *string, allowed []string, name string, short rune, description string) *Option {
+	validShort(short)
+	if len(allowed) == 0 {
+		panic(fmt.Errorf("cli: enum option %q has no allowed values",
+			name))
+	}
+	initial := *s
+	return &Option{
+		Name:        name,
+		Short:       short,
+		Description: description,
+		HasParam:    true,
+		ParamType:   "(" + strings.Join(allowed, "|") + ")",
+		Default:     *s,
+		choices:     allowed,
+		SetValue: func(name, arg string, noParam bool) error {
+			for _, a := range allowed {
+				if arg == a {
+					*s = arg
+					return nil
+				}
+			}
+			return &OptionError{
+				Option: name,
+				Msg: fmt.Sprintf("invalid value %q; valid values are %s",
+					arg, strings.Join(allowed, ", ")),
+				Suggestion: suggest(arg, allowed),
+			}
+		},
+		ResetValue: func() { *s = initial },
+		GetValue:   func() interface{} { return *s },
+	}
+}
+
+// PathOption creates a string flag for a file system path. The parameter is
+// expanded by ExpandPath. The default value is the value that s has when the
+// function is called; it is not expanded.
+func PathOption(s *string, name string, short rune, description string) *Option {
+	opt := StringOption(s, name, short, description)
+	opt.ParamType = "path"
+	opt.Transform = ExpandPath
+	return opt
+}
+
+// ExpandPath replaces a leading ~ by the home directory of the user and
+// references to environment variables in the form $VAR or ${VAR} by their
+// values. Undefined variables are replaced by the empty string. If the home
+// directory cannot be determined, for instance because $HOME is not set, the
+// ~ is kept. The form ~user is not supported.
+func ExpandPath(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") ||
+		strings.HasPrefix(path, "~"+string(filepath.Separator)) {
+		if home, err := os.UserHomeDir(); err == nil {
+			return home + os.ExpandEnv(path[1:])
+		}
 	}
+	return os.ExpandEnv(path)
 }
 
 // IntOption creates an integer flag. The default value is the value of n when
@@ -180,6 +532,7 @@ func StringOption(s *string, name string, short rune, description string) *Optio
 func IntOption(n *int, name string, short rune, description string) *Option {
 	validShort(short)
 	const intSize = 32 << (^uint(0) >> 63)
+	initial := *n
 	var def string
 	if *n != 0 {
 		def = fmt.Sprintf("%d", *n)
@@ -201,6 +554,108 @@ func IntOption(n *int, name string, short rune, description string) *Option {
 			*n = int(i)
 			return nil
 		},
+		ResetValue: func() { *n = initial },
+		GetValue:   func() interface{} { return *n },
+	}
+}
+
+// Int64Option creates a 64-bit integer flag. The default value is the value of
+// n when this function is called. Integers in the form of 0b101, 0xf5 or 0234
+// are supported.
+func Int64Option(n *int64, name string, short rune, description string) *Option {
+	validShort(short)
+	initial := *n
+	var def string
+	if *n != 0 {
+		def = fmt.Sprintf("%d", *n)
+	}
+	return &Option{
+		Name:        name,
+		Short:       short,
+		Description: description,
+		HasParam:    true,
+		ParamType:   "int64",
+		Default:     def,
+		SetValue: func(name, arg string, noParam bool) error {
+			i, err := strconv.ParseInt(arg, 0, 64)
+			if err != nil {
+				return err
+			}
+			*n = i
+			return nil
+		},
+		ResetValue: func() { *n = initial },
+		GetValue:   func() interface{} { return *n },
+	}
+}
+
+// parseUint parses an unsigned integer with the given bit size. Negative
+// values are reported as such and not as syntax errors.
+func parseUint(s string, bitSize int) (uint64, error) {
+	if strings.HasPrefix(s, "-") {
+		return 0, fmt.Errorf("negative value %s not allowed", s)
+	}
+	return strconv.ParseUint(s, 0, bitSize)
+}
+
+// UintOption creates an unsigned integer flag. The default value is the value
+// of n when this function is called. Integers in the form of 0b101, 0xf5 or
+// 0234 are supported. Negative values are rejected.
+func UintOption(n *uint, name string, short rune, description string) *Option {
+	validShort(short)
+	const uintSize = 32 << (^uint(0) >> 63)
+	initial := *n
+	var def string
+	if *n != 0 {
+		def = fmt.Sprintf("%d", *n)
+	}
+	return &Option{
+		Name:        name,
+		Short:       short,
+		Description: description,
+		HasParam:    true,
+		ParamType:   "uint",
+		Default:     def,
+		SetValue: func(name, arg string, noParam bool) error {
+			u, err := parseUint(arg, uintSize)
+			if err != nil {
+				return err
+			}
+			*n = uint(u)
+			return nil
+		},
+		ResetValue: func() { *n = initial },
+		GetValue:   func() interface{} { return *n },
+	}
+}
+
+// Uint64Option creates a 64-bit unsigned integer flag. The default value is the
+// value of n when this function is called. Integers in the form of 0b101, 0xf5
+// or 0234 are supported. Negative values are rejected.
+func Uint64Option(n *uint64, name string, short rune, description string) *Option {
+	validShort(short)
+	initial := *n
+	var def string
+	if *n != 0 {
+		def = fmt.Sprintf("%d", *n)
+	}
+	return &Option{
+		Name:        name,
+		Short:       short,
+		Description: description,
+		HasParam:    true,
+		ParamType:   "uint64",
+		Default:     def,
+		SetValue: func(name, arg string, noParam bool) error {
+			u, err := parseUint(arg, 64)
+			if err != nil {
+				return err
+			}
+			*n = u
+			return nil
+		},
+		ResetValue: func() { *n = initial },
+		GetValue:   func() interface{} { return *n },
 	}
 }
 
@@ -209,6 +664,7 @@ func IntOption(n *int, name string, short rune, description string) *Option {
 // the Go language are supported.
 func Float64Option(f *float64, name string, short rune, description string) *Option {
 	validShort(short)
+	initial := *f
 	var def string
 	if *f != 0 {
 		def = fmt.Sprintf("%g", *f)
@@ -230,20 +686,247 @@ func Float64Option(f *float64, name string, short rune, description string) *Opt
 			*f = x
 			return nil
 		},
+		ResetValue: func() { *f = initial },
+		GetValue:   func() interface{} { return *f },
 	}
-
 }
 
-func findOption(flags []*Option, name string) (f *Option, ok bool) {
-	for _, f := range flags {
-		if f.hasName(name) {
-			return f, true
+// parseQuantity parses a number followed by a unit of the table and returns the
+// value in the base unit. The longest matching unit is used. A number without
+// unit is taken as base unit unless the table maps the empty string.
+func parseQuantity(s string, unitTable map[string]float64) (float64, error) {
+	s = strings.TrimSpace(s)
+	units := make([]string, 0, len(unitTable))
+	for u := range unitTable {
+		if u != "" {
+			units = append(units, u)
 		}
-		if f.hasShortString(name) {
-			return f, true
+	}
+	sort.Slice(units, func(i, j int) bool {
+		if len(units[i]) != len(units[j]) {
+			return len(units[i]) > len(units[j])
+		}
+		return units[i] < units[j]
+	})
+	for _, u := range units {
+		if !strings.HasSuffix(s, u) {
+			continue
+		}
+		num := strings.TrimSpace(strings.TrimSuffix(s, u))
+		if x, err := strconv.ParseFloat(num, 64); err == nil {
+			return x * unitTable[u], nil
 		}
 	}
-	return nil, false
+	if x, err := strconv.ParseFloat(s, 64); err == nil {
+		if m, ok := unitTable[""]; ok {
+			return x * m, nil
+		}
+		return x, nil
+	}
+	i := strings.LastIndexAny(s, "0123456789.") + 1
+	unit := strings.TrimSpace(s[i:])
+	if i == 0 || unit == "" {
+		return 0, fmt.Errorf("invalid quantity %q", s)
+	}
+	sort.Strings(units)
+	return 0, &OptionError{
+		Msg: fmt.Sprintf("unknown unit %q; valid units are %s",
+			unit, strings.Join(units, ", ")),
+		Suggestion: suggest(unit, units),
+	}
+}
+
+// QuantityOption creates a flag for a number followed by a unit, e.g. 500ms.
+// The unit table maps the units to the multipliers converting the number into
+// the base unit, e.g. {"ms": 1e-3, "s": 1, "m": 60} for seconds. The value is
+// stored in the base unit. A number without unit is taken as base unit. The
+// default value is the value of v when called.
+func QuantityOption(v *float64, unitTable map[string]float64, name string, short rune, description string) *Option {
+	validShort(short)
+	initial := *v
+	var def string
+	if *v != 0 {
+		def = fmt.Sprintf("%g", *v)
+	}
+	return &Option{
+		Name:        name,
+		Short:       short,
+		Description: description,
+		HasParam:    true,
+		ParamType:   "quantity",
+		Default:     def,
+		SetValue: func(name, arg string, noParam bool) error {
+			x, err := parseQuantity(arg, unitTable)
+			if err != nil {
+				var oe *OptionError
+				if errors.As(err, &oe) {
+					oe.Option = name
+				}
+				return err
+			}
+			*v = x
+			return nil
+		},
+		ResetValue: func() { *v = initial },
+		GetValue:   func() interface{} { return *v },
+	}
+}
+
+// Now returns the current time. It is used by TimeOption for relative times and
+// should be used for all defaults depending on the current time, so that tests
+// can replace it by a fixed clock.
+var Now = time.Now
+
+// TimeOption creates a flag for a point in time. The parameter is either a
+// time in RFC 3339 format, e.g. 2006-01-02T15:04:05Z, or a duration as
+// accepted by time.ParseDuration, which is added to the time returned by Now,
+// e.g. -1h for one hour ago. Since a negative duration looks like an option,
+// it must be attached with =, as in --since=-1h. The default value is the
+// value of t when called.
+func TimeOption(t *time.Time, name string, short rune, description string) *Option {
+	validShort(short)
+	initial := *t
+	var def string
+	if !t.IsZero() {
+		def = t.Format(time.RFC3339)
+	}
+	return &Option{
+		Name:        name,
+		Short:       short,
+		Description: description,
+		HasParam:    true,
+		ParamType:   "time",
+		Default:     def,
+		SetValue: func(name, arg string, noParam bool) error {
+			if d, err := time.ParseDuration(arg); err == nil {
+				*t = Now().Add(d)
+				return nil
+			}
+			u, err := time.Parse(time.RFC3339, arg)
+			if err != nil {
+				return fmt.Errorf(
+					"%q is neither a RFC 3339 time nor a duration",
+					arg)
+			}
+			*t = u
+			return nil
+		},
+		ResetValue: func() { *t = initial },
+		GetValue:   func() interface{} { return *t },
+	}
+}
+
+// StringSliceOption creates a repeatable flag that appends the parameter of
+// every use to s, e.g. -I a -I b collects a and b in that order. The argument s
+// will be set to an empty slice; resetting the option empties it again.
+func StringSliceOption(s *[]string, name string, short rune, description string) *Option {
+	validShort(short)
+	*s = nil
+	return &Option{
+		Name:        name,
+		Short:       short,
+		Description: description,
+		HasParam:    true,
+		ParamType:   "string",
+		Repeatable:  true,
+		Default:     "",
+		SetValue: func(name, arg string, noParam bool) error {
+			*s = append(*s, arg)
+			return nil
+		},
+		ResetValue: func() { *s = nil },
+		GetValue:   func() interface{} { return *s },
+	}
+}
+
+// CSVOption creates a flag for a list of strings. The parameter is split at
+// commas following the rules of encoding/csv, so a field enclosed in double
+// quotes may contain commas. The first use of the flag replaces the default,
+// which is the value of s when called; further uses append to the list.
+func CSVOption(s *[]string, name string, short rune, description string) *Option {
+	validShort(short)
+	initial := *s
+	set := false
+	return &Option{
+		Name:        name,
+		Short:       short,
+		Description: description,
+		HasParam:    true,
+		ParamType:   "list",
+		Default:     strings.Join(*s, ","),
+		SetValue: func(name, arg string, noParam bool) error {
+			r := csv.NewReader(strings.NewReader(arg))
+			fields, err := r.Read()
+			if err == io.EOF {
+				fields, err = []string{}, nil
+			}
+			if err != nil {
+				return err
+			}
+			if !set {
+				*s = nil
+				set = true
+			}
+			*s = append(*s, fields...)
+			return nil
+		},
+		ResetValue: func() {
+			*s = initial
+			set = false
+		},
+		GetValue: func() interface{} { return *s },
+	}
+}
+
+// HexOption creates a flag for a byte slice given as hexadecimal string. The
+// default value is the value of b when called.
+func HexOption(b *[]byte, name string, short rune, description string) *Option {
+	validShort(short)
+	initial := *b
+	return &Option{
+		Name:        name,
+		Short:       short,
+		Description: description,
+		HasParam:    true,
+		ParamType:   "hex",
+		Default:     hex.EncodeToString(*b),
+		SetValue: func(name, arg string, noParam bool) error {
+			p, err := hex.DecodeString(arg)
+			if err != nil {
+				return err
+			}
+			*b = p
+			return nil
+		},
+		ResetValue: func() { *b = initial },
+		GetValue:   func() interface{} { return *b },
+	}
+}
+
+// Base64Option creates a flag for a byte slice given in the standard base64
+// encoding with padding as defined in RFC 4648. The default value is the
+// value of b when called.
+func Base64Option(b *[]byte, name string, short rune, description string) *Option {
+	validShort(short)
+	initial := *b
+	return &Option{
+		Name:        name,
+		Short:       short,
+		Description: description,
+		HasParam:    true,
+		ParamType:   "base64",
+		Default:     base64.StdEncoding.EncodeToString(*b),
+		SetValue: func(name, arg string, noParam bool) error {
+			p, err := base64.StdEncoding.DecodeString(arg)
+			if err != nil {
+				return err
+			}
+			*b = p
+			return nil
+		},
+		ResetValue: func() { *b = initial },
+		GetValue:   func() interface{} { return *b },
+	}
 }
 
 // Usage returns the one-line string for the option.
@@ -253,7 +936,10 @@ func (opt *Option) Usage() string {
 	}
 	var ptype string
 	if opt.HasParam {
-		ptype = opt.ParamType
+		ptype = opt.Placeholder
+		if ptype == "" {
+			ptype = opt.ParamType
+		}
 		if ptype == "" {
 			ptype = "param"
 		}
@@ -261,12 +947,14 @@ func (opt *Option) Usage() string {
 	var sb strings.Builder
 	i := 0
 
-	if shorts := opt.AllShorts(); len(shorts) > 0 {
-		fmt.Fprint(&sb, "-")
-		i++
-		for _, r := range shorts {
-			fmt.Fprintf(&sb, "%c", r)
+	// Alternative short options are separated by commas to distinguish
+	// them from bundled short options.
+	for _, r := range opt.AllShorts() {
+		if i > 0 {
+			fmt.Fprintf(&sb, ", ")
 		}
+		fmt.Fprintf(&sb, "-%c", r)
+		i++
 		if opt.HasParam {
 			if opt.OptionalParam {
 				fmt.Fprintf(&sb, " [%s]", ptype)
@@ -281,7 +969,11 @@ func (opt *Option) Usage() string {
 			if i > 0 {
 				fmt.Fprintf(&sb, ", ")
 			}
-			fmt.Fprintf(&sb, "--%s", n)
+			if opt.Negatable && !opt.HasParam {
+				fmt.Fprintf(&sb, "--[no-]%s", n)
+			} else {
+				fmt.Fprintf(&sb, "--%s", n)
+			}
 			i++
 			if opt.HasParam {
 				if opt.OptionalParam {
@@ -292,34 +984,57 @@ func (opt *Option) Usage() string {
 			}
 		}
 	}
-	if opt.Default != "" {
-		fmt.Fprintf(&sb, " (default %s)", opt.Default)
+	if opt.Repeatable {
+		sb.WriteString(" ...")
+	}
+	if opt.EnvVar != "" && !opt.HideEnvVar {
+		fmt.Fprintf(&sb, " [$%s]", opt.EnvVar)
+	}
+	def := opt.Default
+	if def == "" && opt.DefaultTemplate != "" {
+		def, _ = opt.evalDefaultTemplate(newTemplateContext(nil))
+	}
+	if def != "" && !opt.HideDefault && !opt.Secret {
+		fmt.Fprintf(&sb, " (default %s)", def)
 	}
 	return sb.String()
 }
 
-// UsageOptions returns a textual list of all options sorted by alphabet. Usage
-// information for an option will be preceded by indent1 and the description by
-// indent1+indent2 formatted on 80 character lines.
-func UsageOptions(w io.Writer, opts []*Option, indent1, indent2 string) (n int, err error) {
-	names := make([]string, 0, len(opts)+32)
+// sortOptions returns the options sorted by their first short or long name.
+// Options without names are dropped.
+func sortOptions(opts []*Option) []*Option {
+	// Options are kept as keys, so that options sharing names are all
+	// listed.
+	type entry struct {
+		key string
+		opt *Option
+	}
+	entries := make([]entry, 0, len(opts))
 	for _, f := range opts {
-		shorts := f.AllShorts()
-		if len(shorts) > 0 {
-			names = append(names, string(shorts[0]))
+		if shorts := f.AllShorts(); len(shorts) > 0 {
+			entries = append(entries, entry{string(shorts[0]), f})
 			continue
 		}
-		fNames := f.AllNames()
-		if len(fNames) > 0 {
-			names = append(names, fNames[0])
+		if names := f.AllNames(); len(names) > 0 {
+			entries = append(entries, entry{names[0], f})
 		}
 	}
-	sort.Strings(names)
-	for _, s := range names {
-		f, ok := findOption(opts, s)
-		if !ok {
-			panic("we should know the string")
-		}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].key < entries[j].key
+	})
+	sorted := make([]*Option, len(entries))
+	for i, e := range entries {
+		sorted[i] = e.opt
+	}
+	return sorted
+}
+
+// UsageOptions returns a textual list of all options sorted by alphabet. Usage
+// information for an option will be preceded by indent1 and the description by
+// indent1+indent2 formatted on 80 character lines. Experimental options are
+// omitted unless they are enabled.
+func UsageOptions(w io.Writer, opts []*Option, indent1, indent2 string) (n int, err error) {
+	for _, f := range sortOptions(visibleOptions(opts)) {
 		k, err := fmt.Fprint(w, indent1)
 		n += k
 		if err != nil {
@@ -335,7 +1050,7 @@ func UsageOptions(w io.Writer, opts []*Option, indent1, indent2 string) (n int,
 		if err != nil {
 			return n, err
 		}
-		k, err = formatText(w, f.Description, 80, indent1+indent2)
+		k, err = FormatText(w, f.Description, 80, indent1+indent2)
 		n += k
 		if err != nil {
 			return n, err
@@ -345,6 +1060,108 @@ func UsageOptions(w io.Writer, opts []*Option, indent1, indent2 string) (n int,
 	return n, nil
 }
 
+// OptionSet is a set of options that may be shared by multiple commands, for
+// instance logging options.
+type OptionSet []*Option
+
+// checkCollisions returns an error if an option in set uses a name or short
+// already used by an option in options or another option in set.
+func checkCollisions(options []*Option, set []*Option) error {
+	names := make(map[string]bool)
+	shorts := make(map[rune]bool)
+	add := func(opt *Option) error {
+		for _, name := range opt.AllNames() {
+			if names[name] {
+				return &OptionError{
+					Option: name,
+					Msg: fmt.Sprintf(
+						"option --%s defined twice", name),
+				}
+			}
+			names[name] = true
+		}
+		for _, r := range opt.AllShorts() {
+			if shorts[r] {
+				return &OptionError{
+					Option: string(r),
+					Msg: fmt.Sprintf(
+						"option -%c defined twice", r),
+				}
+			}
+			shorts[r] = true
+		}
+		return nil
+	}
+	for _, opt := range options {
+		if err := add(opt); err != nil {
+			return err
+		}
+	}
+	for _, opt := range set {
+		if err := add(opt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddOptionSet appends the options of the set to the options of the command.
+// The command is not modified if a long or short option name is used twice.
+func AddOptionSet(cmd *Command, set OptionSet) error {
+	if err := checkCollisions(cmd.localOptions(), set); err != nil {
+		return &CommandError{Name: cmd.Name, Wrapped: err}
+	}
+	cmd.Options = append(cmd.Options, set...)
+	return nil
+}
+
+// OptionsSummary returns a compact comma-separated list of the options, e.g.
+// "-v/--verbose, -o/--output". It is intended for error messages.
+func OptionsSummary(options []*Option) string {
+	var sb strings.Builder
+	for i, opt := range options {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		j := 0
+		for _, r := range opt.AllShorts() {
+			if j > 0 {
+				sb.WriteByte('/')
+			}
+			fmt.Fprintf(&sb, "-%c", r)
+			j++
+		}
+		for _, name := range opt.AllNames() {
+			if j > 0 {
+				sb.WriteByte('/')
+			}
+			fmt.Fprintf(&sb, "--%s", name)
+			j++
+		}
+	}
+	return sb.String()
+}
+
+// OptString returns the short options in the format of the optstring of
+// getopt, e.g. "hvo:f:". A colon follows options requiring a parameter and two
+// colons, a GNU extension, follow options with an optional parameter. Options
+// without short names are omitted.
+func OptString(options []*Option) string {
+	var sb strings.Builder
+	for _, opt := range options {
+		for _, r := range opt.AllShorts() {
+			sb.WriteRune(r)
+			if opt.HasParam {
+				sb.WriteByte(':')
+				if opt.OptionalParam {
+					sb.WriteByte(':')
+				}
+			}
+		}
+	}
+	return sb.String()
+}
+
 func unrecognizedOptionError(arg string) error {
 	return &OptionError{
 		Option: "unrecognized",
@@ -352,9 +1169,200 @@ func unrecognizedOptionError(arg string) error {
 	}
 }
 
-func handleLongOption(options []*Option, args []string) (argsUsed int, err error) {
+// isOptionArg reports whether the argument is an option. A single dash is not
+// an option; it is a valid parameter denoting standard input or output.
+func isOptionArg(a string) bool {
+	return len(a) > 1 && a[0] == '-'
+}
+
+// optionParser parses the options of a command line.
+type optionParser struct {
+	options []*Option
+	// debug receives a trace of the parsing decisions if it is not nil.
+	debug io.Writer
+	// stopOnFirstError stops the parsing at the first option error.
+	stopOnFirstError bool
+	// offset is the index of the first argument given to parse in the
+	// complete argument list.
+	offset int
+	// disableDashDash stops the parsing at "--" without consuming it.
+	disableDashDash bool
+	// lenientBooleans accepts values attached to the long names of
+	// boolean flags.
+	lenientBooleans bool
+	// diagnostics collects the warnings if it is not nil; otherwise they
+	// are printed.
+	diagnostics *Diagnostics
+	// command is the name of the command whose options are parsed.
+	command string
+	// immediate records that an immediate option has been set.
+	immediate bool
+	// dashDash records that the parsing stopped at "--" and consumed it.
+	dashDash bool
+}
+
+// setArgIndex records the index of the argument causing the error.
+func (p *optionParser) setArgIndex(err error, i int) {
+	var oe *OptionError
+	if errors.As(err, &oe) {
+		oe.ArgIndex = p.offset + i
+	}
+}
+
+// dashName returns the option name with its leading dashes.
+func (opt *Option) dashName(name string) string {
+	if opt.hasShortString(name) {
+		return "-" + name
+	}
+	return "--" + name
+}
+
+// ExperimentalEnv is the name of the environment variable that enables
+// experimental options. Programs should set it to a name specific to them,
+// e.g. FOO_ENABLE_EXPERIMENTAL for the program foo.
+var ExperimentalEnv = "CLI_ENABLE_EXPERIMENTAL"
+
+// experimentalEnabled reports whether the environment variable ExperimentalEnv
+// enables experimental options.
+func experimentalEnabled() bool {
+	b, err := parseBool(os.Getenv(ExperimentalEnv))
+	return err == nil && b
+}
+
+// checkExperimental returns an error if the option is experimental and
+// experimental options are not enabled.
+func (opt *Option) checkExperimental(name string) error {
+	if !opt.Experimental || experimentalEnabled() {
+		return nil
+	}
+	return &OptionError{
+		Option: name,
+		Msg: fmt.Sprintf("option %s is experimental; set %s=1 to use it",
+			opt.dashName(name), ExperimentalEnv),
+	}
+}
+
+// visibleOptions returns the options that are shown in the usage information.
+// Experimental options are hidden unless they are enabled.
+func visibleOptions(options []*Option) []*Option {
+	if experimentalEnabled() {
+		return options
+	}
+	visible := make([]*Option, 0, len(options))
+	for _, o := range options {
+		if !o.Experimental {
+			visible = append(visible, o)
+		}
+	}
+	return visible
+}
+
+// missingParamError returns the error for an option name used without the
+// required parameter.
+func (opt *Option) missingParamError(name string) *OptionError {
+	msg := opt.ParamErrorMsg
+	if msg == "" {
+		msg = fmt.Sprintf("option %s requires a parameter",
+			opt.dashName(name))
+	}
+	return &OptionError{Option: name, Msg: msg}
+}
+
+// setValue calls the SetValue function of the option, traces the call if
+// requested and warns about deprecated options.
+func (p *optionParser) setValue(opt *Option, name, param string, noParam bool) error {
+	if opt.Deprecated != "" {
+		msg := fmt.Sprintf("option %s is deprecated; %s",
+			opt.dashName(name), opt.Deprecated)
+		if p.diagnostics != nil {
+			p.diagnostics.Add(Diagnostic{
+				Severity: SeverityWarning,
+				Command:  p.command,
+				Option:   opt.dashName(name),
+				Message:  msg,
+			})
+		} else {
+			warnOnce(msg)
+		}
+	}
+	if p.debug != nil {
+		if noParam {
+			fmt.Fprintf(p.debug, "cli: option %s\n", name)
+		} else {
+			fmt.Fprintf(p.debug, "cli: option %s parameter %q\n",
+				name, param)
+		}
+	}
+	if err := opt.set(sourceCommandLine, name, param, noParam); err != nil {
+		return err
+	}
+	if opt.Immediate {
+		p.immediate = true
+	}
+	return nil
+}
+
+// Sources of option values
+const (
+	sourceCommandLine = "command line"
+	sourceEnv         = "environment"
+	sourcePrompt      = "prompt"
+)
+
+// set applies Transform and ValueAliases to the parameter and calls SetValue.
+// If SetValue succeeds, it marks the option as seen and records the source of
+// the value.
+func (opt *Option) set(source, name, param string, noParam bool) error {
+	if !noParam {
+		if opt.Transform != nil {
+			param = opt.Transform(param)
+		}
+		if v, ok := opt.ValueAliases[param]; ok {
+			param = v
+		}
+	}
+	if err := opt.SetValue(name, param, noParam); err != nil {
+		return err
+	}
+	opt.seen = true
+	opt.source = source
+	return nil
+}
+
+// helpSeen reports whether the help option is part of options and has been
+// given.
+func helpSeen(options []*Option) bool {
+	for _, o := range options {
+		if o.help && o.seen {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRequired reports the required options that have not been seen.
+func checkRequired(options []*Option) error {
+	var errList errorList
+	for _, o := range options {
+		if !o.Required || o.seen {
+			continue
+		}
+		name := o.Name
+		if name == "" {
+			name = string(o.Short)
+		}
+		errList = append(errList, &OptionError{
+			Option: name,
+			Msg: fmt.Sprintf("required option %s not set",
+				o.dashName(name)),
+		})
+	}
+	return errList.Flatten()
+}
+
+func (p *optionParser) handleLongOption(args []string) (argsUsed int, err error) {
 	for i, a := range args[1:] {
-		if len(a) > 0 && a[0] == '-' {
+		if isOptionArg(a) {
 			args = args[:i+1]
 			break
 		}
@@ -371,8 +1379,11 @@ func handleLongOption(options []*Option, args []string) (argsUsed int, err error
 		return 1, unrecognizedOptionError(arg)
 	}
 
-	var found *Option
-	for _, o := range options {
+	var (
+		found   *Option
+		negated bool
+	)
+	for _, o := range p.options {
 		for _, name := range o.AllNames() {
 			if strings.HasPrefix(name, option) {
 				if found != nil {
@@ -382,24 +1393,66 @@ func handleLongOption(options []*Option, args []string) (argsUsed int, err error
 				found = o
 			}
 		}
+		// The negated names require a name following the prefix.
+		if !o.Negatable || o.HasParam || len(option) <= len("no-") {
+			continue
+		}
+		for _, name := range o.AllNames() {
+			if strings.HasPrefix("no-"+name, option) {
+				if found != nil {
+					return 0, unrecognizedOptionError(arg)
+				}
+				option = "no-" + name
+				found = o
+				negated = true
+			}
+		}
 	}
 	if found == nil {
 		return 1, unrecognizedOptionError(arg)
 	}
+	if err = found.checkExperimental(option); err != nil {
+		return 1, err
+	}
 
 	if !found.HasParam {
+		if k >= 0 && p.lenientBooleans && !negated && found.isBool() {
+			b, err := strconv.ParseBool(arg[k+1:])
+			if err != nil {
+				return 1, &OptionError{Option: option,
+					Msg: fmt.Sprintf(
+						"invalid boolean value %q for option --%s",
+						arg[k+1:], option),
+					Wrapped: err}
+			}
+			param := strconv.FormatBool(b)
+			if err = p.setValue(found, option, param, false); err != nil {
+				return 1, &OptionError{Option: option,
+					Msg: fmt.Sprintf(
+						"error setting value %q for option --%s",
+						param, option),
+					Wrapped:    err,
+					Suggestion: suggestionOf(err)}
+			}
+			return 1, nil
+		}
 		if k >= 0 {
 			return 1, &OptionError{Option: option,
 				Msg: fmt.Sprintf(
-					"option --%s requires no parameter",
+					"option --%s takes no parameter",
 					option)}
 		}
-		if err = found.SetValue(option, "", true); err != nil {
+		param, noParam := "", true
+		if negated {
+			param, noParam = "false", false
+		}
+		if err = p.setValue(found, option, param, noParam); err != nil {
 			return 1, &OptionError{Option: option,
 				Msg: fmt.Sprintf(
 					"error setting value for option --%s",
 					option),
-				Wrapped: err}
+				Wrapped:    err,
+				Suggestion: suggestionOf(err)}
 		}
 		return 1, nil
 	}
@@ -409,12 +1462,16 @@ func handleLongOption(options []*Option, args []string) (argsUsed int, err error
 		noParam bool
 	)
 	if k < 0 {
-		if len(args) == 1 {
+		if found.RequireEquals && !found.OptionalParam {
+			return 1, &OptionError{
+				Option: option,
+				Msg: fmt.Sprintf("option --%s requires a parameter"+
+					" in the form --%[1]s=value", option),
+			}
+		}
+		if len(args) == 1 || found.RequireEquals {
 			if !found.OptionalParam {
-				return 1, &OptionError{Option: option,
-					Msg: fmt.Sprintf("no parameter for option --%s",
-						option),
-				}
+				return 1, found.missingParamError(option)
 			}
 			noParam = true
 			argsUsed = 1
@@ -427,31 +1484,32 @@ func handleLongOption(options []*Option, args []string) (argsUsed int, err error
 		argsUsed = 1
 	}
 
-	if err = found.SetValue(option, param, noParam); err != nil {
+	if err = p.setValue(found, option, param, noParam); err != nil {
 		return argsUsed, &OptionError{
 			Option: option,
 			Msg: fmt.Sprintf("error setting value %q for option --%s",
 				param, option),
-			Wrapped: err,
+			Wrapped:    err,
+			Suggestion: suggestionOf(err),
 		}
 	}
 
 	return argsUsed, nil
 }
 
-func handleShortOptions(options []*Option, args []string) (argsUsed int, err error) {
+func (p *optionParser) handleShortOptions(args []string) (argsUsed int, err error) {
 	for i, a := range args[1:] {
-		if len(a) > 0 && a[0] == '-' {
+		if isOptionArg(a) {
 			args = args[:i+1]
 			break
 		}
 	}
 	arg := args[0]
 	i := 1
-	for _, short := range arg[1:] {
+	for j, short := range arg[1:] {
 		option := string(short)
 		var found *Option
-		for _, o := range options {
+		for _, o := range p.options {
 			if o.hasShortString(option) {
 				found = o
 				break
@@ -460,15 +1518,32 @@ func handleShortOptions(options []*Option, args []string) (argsUsed int, err err
 		if found == nil {
 			return i, unrecognizedOptionError(option)
 		}
+		if err = found.checkExperimental(option); err != nil {
+			return i, err
+		}
 
 		if !found.HasParam {
-			if err = found.SetValue(option, "", true); err != nil {
+			// An attached =value, e.g. -h=foo, is an error and
+			// not a sequence of further short options.
+			if strings.HasPrefix(arg[1+j+len(option):], "=") {
+				return i, &OptionError{
+					Option: option,
+					Msg: fmt.Sprintf(
+						"option -%s takes no parameter",
+						option),
+				}
+			}
+			if err = p.setValue(found, option, "", true); err != nil {
 				return i, &OptionError{
 					Option: option,
 					Msg: fmt.Sprintf(
 						"error setting value for"+
 							" option -%s", option),
-					Wrapped: err}
+					Wrapped:    err,
+					Suggestion: suggestionOf(err)}
+			}
+			if p.immediate {
+				return i, nil
 			}
 			continue
 		}
@@ -479,26 +1554,25 @@ func handleShortOptions(options []*Option, args []string) (argsUsed int, err err
 		)
 		if i >= len(args) {
 			if !found.OptionalParam {
-				return i, &OptionError{
-					Option: option,
-					Msg: fmt.Sprintf(
-						"option -%s lacks parameter",
-						option),
-				}
+				return i, found.missingParamError(option)
 			}
 			noParam = true
 		} else {
 			param = args[i]
 			i++
 		}
-		if err = found.SetValue(option, param, noParam); err != nil {
+		if err = p.setValue(found, option, param, noParam); err != nil {
 			return i, &OptionError{
 				Option: option,
 				Msg: fmt.Sprintf("error setting value %s for option %s",
 					param, option),
-				Wrapped: err,
+				Wrapped:    err,
+				Suggestion: suggestionOf(err),
 			}
 		}
+		if p.immediate {
+			return i, nil
+		}
 	}
 	return i, nil
 }
@@ -508,6 +1582,13 @@ type OptionError struct {
 	Option  string
 	Msg     string
 	Wrapped error
+	// ArgIndex is the index of the argument that caused the error in the
+	// argument list given to ParseOptions or Parse.
+	ArgIndex int
+	// Suggestion is a valid value that the user might have meant. A
+	// SetValue function rejecting a parameter may return an OptionError
+	// with a suggestion; the parser copies it into the error it returns.
+	Suggestion string
 }
 
 func (err *OptionError) Error() string {
@@ -515,6 +1596,9 @@ func (err *OptionError) Error() string {
 	if msg == "" {
 		msg = fmt.Sprintf("option error for %s", msg)
 	}
+	if err.Suggestion != "" && suggestionOf(err.Wrapped) != err.Suggestion {
+		msg = fmt.Sprintf("%s; did you mean %q?", msg, err.Suggestion)
+	}
 	if err.Wrapped != nil {
 		return fmt.Sprintf("%s: %s", msg, err.Wrapped)
 	}
@@ -531,6 +1615,16 @@ func (err *OptionError) Is(e error) bool {
 
 func (err *OptionError) Unwrap() error { return err.Wrapped }
 
+// suggestionOf returns the suggestion of the first OptionError in the chain of
+// err.
+func suggestionOf(err error) string {
+	var oe *OptionError
+	if errors.As(err, &oe) {
+		return oe.Suggestion
+	}
+	return ""
+}
+
 // errorList is represented by a slice of errors. It should be used if multiple
 // errors should be returned by a function. It behaves itself as an error.
 type errorList []error
@@ -571,6 +1665,15 @@ func (err errorList) Error() string {
 	return sb.String()
 }
 
+// As finds the first error in the list that matches target. The other errors
+// are reached by Unwrap.
+func (err errorList) As(target interface{}) bool {
+	if len(err) == 0 {
+		return false
+	}
+	return errors.As(err[0], target)
+}
+
 func (err errorList) Is(e error) bool {
 	if el, ok := e.(errorList); ok {
 		if len(err) != len(el) {
@@ -589,47 +1692,189 @@ func (err errorList) Is(e error) bool {
 	return errors.Is(err[0], e)
 }
 
+// Errors returns the individual errors of an error returned by Parse, Run or
+// ParseOptions. Multiple option errors are reported as a single error, which
+// Errors splits. If the list is wrapped by a CommandError, each error is
+// wrapped the same way. Any other error is returned as the only element and
+// a nil error results in a nil slice.
+func Errors(err error) []error {
+	switch e := err.(type) {
+	case nil:
+		return nil
+	case errorList:
+		var errs []error
+		for _, x := range e {
+			errs = append(errs, Errors(x)...)
+		}
+		return errs
+	case *CommandError:
+		inner := Errors(e.Wrapped)
+		if len(inner) <= 1 {
+			return []error{err}
+		}
+		errs := make([]error, len(inner))
+		for i, x := range inner {
+			errs[i] = &CommandError{
+				Name:    e.Name,
+				Message: e.Message,
+				Wrapped: x,
+			}
+		}
+		return errs
+	}
+	return []error{err}
+}
+
+// FormatErrorList writes err to w. If err consists of multiple errors as
+// reported by Errors, their number is followed by a numbered list, e.g.
+//
+//	3 errors:
+//	  1. unrecognized option --foo
+//	  2. ...
+//
+// A single error is written on a line of its own. Nothing is written for a nil
+// error.
+func FormatErrorList(err error, w io.Writer) {
+	errs := Errors(err)
+	switch len(errs) {
+	case 0:
+		return
+	case 1:
+		fmt.Fprintln(w, errs[0])
+		return
+	}
+	fmt.Fprintf(w, "%d errors:\n", len(errs))
+	for i, e := range errs {
+		fmt.Fprintf(w, "  %d. %s\n", i+1, e)
+	}
+}
+
 // ResetOptions resets all options to the default. It may be useful before you
-// are executing Parse a second time on an option set.
+// are executing Parse a second time on an option set. The default templates are
+// applied after all options have been reset, so they can refer to the values
+// of the options without template.
 func ResetOptions(options []*Option) error {
 	var errList errorList
 	for _, o := range options {
-		err := o.Reset()
+		err := o.reset()
 		if err != nil {
 			errList = append(errList, err)
 		}
 	}
+	ctx := newTemplateContext(options)
+	for _, o := range options {
+		if err := o.applyDefaultTemplate(ctx); err != nil {
+			errList = append(errList, err)
+		}
+	}
 	return errList.Flatten()
 }
 
+// ErrImmediate is returned by ParseOptions and Parse after an option with the
+// Immediate field set has been set. The arguments following it are not
+// parsed.
+var ErrImmediate = errors.New("cli: immediate option set")
+
+// ParseFlag modifies the behavior of ParseOptions.
+type ParseFlag int
+
+// Flags for ParseOptions
+const (
+	// StopOnFirstError lets ParseOptions return at the first option
+	// error without setting the values of the options following it, like
+	// the field of the same name of Command does for Parse.
+	StopOnFirstError ParseFlag = 1 << iota
+	// SkipRequired lets ParseOptions skip the check of the required
+	// options, so that they can be set from other sources, e.g. by
+	// LoadOptionsFile, before CheckRequired is called.
+	SkipRequired
+)
+
 // ParseOptions parses the flags and stops at first non-flag or '--'. It returns
-// the number of args parsed.
-func ParseOptions(options []*Option, args []string) (n int, err error) {
+// the number of args parsed. By default all option errors are collected; the
+// flags may modify the behavior. Required options that haven't been set are
+// reported if all options could be parsed; options set before the call don't
+// count. If an immediate option is given, ParseOptions returns ErrImmediate
+// and ignores the errors of preceding options.
+func ParseOptions(options []*Option, args []string, flags ...ParseFlag) (n int, err error) {
+	clearSeenOptions(options)
+	p := &optionParser{options: options}
+	skipRequired := false
+	for _, f := range flags {
+		if f&StopOnFirstError != 0 {
+			p.stopOnFirstError = true
+		}
+		if f&SkipRequired != 0 {
+			skipRequired = true
+		}
+	}
+	if n, err = p.parse(args); err != nil {
+		return n, err
+	}
+	if err = applyDefaultTemplates(options); err != nil || skipRequired {
+		return n, err
+	}
+	return n, CheckRequired(options)
+}
+
+// CheckRequired reports the required options that haven't been set since the
+// last parse or reset as OptionError. Nothing is reported if the help option
+// has been given.
+func CheckRequired(options []*Option) error {
+	if helpSeen(options) {
+		return nil
+	}
+	return checkRequired(options)
+}
+
+func (p *optionParser) parse(args []string) (n int, err error) {
 	i := 0
 	var errList errorList
 	for i < len(args) {
 		a := args[i]
 		if strings.HasPrefix(a, "--") {
 			if a == "--" {
-				return i + 1, nil
+				if p.disableDashDash {
+					return i, errList.Flatten()
+				}
+				p.dashDash = true
+				return i + 1, errList.Flatten()
+			}
+			argsUsed, err := p.handleLongOption(args[i:])
+			if err != nil {
+				p.setArgIndex(err, i)
 			}
-			argsUsed, err := handleLongOption(options, args[i:])
 			i += argsUsed
+			if p.immediate {
+				return i, ErrImmediate
+			}
 			if err != nil {
 				errList = append(errList, err)
+				if p.stopOnFirstError {
+					break
+				}
 			}
 			continue
 		}
 
 		if strings.HasPrefix(a, "-") {
 			if a == "-" {
-				return i, nil
+				return i, errList.Flatten()
 			}
 
-			argsUsed, err := handleShortOptions(options, args[i:])
+			argsUsed, err := p.handleShortOptions(args[i:])
+			if err != nil {
+				p.setArgIndex(err, i)
+			}
 			i += argsUsed
+			if p.immediate {
+				return i, ErrImmediate
+			}
 			if err != nil {
 				errList = append(errList, err)
+				if p.stopOnFirstError {
+					break
+				}
 			}
 			continue
 		}
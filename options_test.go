@@ -5,9 +5,16 @@
 package cli_test
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/ulikunitz/cli"
 )
@@ -54,6 +61,9 @@ func TestParseOptions(t *testing.T) {
 		{args: []string{"--str"}, err: &cli.OptionError{Option: "str"}},
 		{args: []string{"-fs", "foo", "bar"},
 			str: "foo", f: true, n: 2},
+		{args: []string{"--str", "-", "bar"}, str: "-", n: 2},
+		{args: []string{"-s", "-", "bar"}, str: "-", n: 2},
+		{args: []string{"-fs", "-"}, str: "-", f: true, n: 2},
 	}
 
 	var sb strings.Builder
@@ -142,3 +152,1585 @@ func TestNoShortOption(t *testing.T) {
 	}
 
 }
+
+func TestBoolOptionParam(t *testing.T) {
+	var f bool
+	opt := cli.BoolOption(&f, "debug", 'd', "debug mode")
+
+	tests := []struct {
+		param   string
+		noParam bool
+		want    bool
+		err     bool
+	}{
+		{noParam: true, want: true},
+		{param: "1", want: true},
+		{param: "true", want: true},
+		{param: "yes", want: true},
+		{param: "0", want: false},
+		{param: "false", want: false},
+		{param: "no", want: false},
+		{param: "foo", err: true},
+	}
+	for _, tc := range tests {
+		f = !tc.want
+		err := opt.SetValue("debug", tc.param, tc.noParam)
+		if tc.err {
+			if err == nil {
+				t.Errorf("SetValue(%q, %t) returned no error",
+					tc.param, tc.noParam)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("SetValue(%q, %t) error %s",
+				tc.param, tc.noParam, err)
+		}
+		if f != tc.want {
+			t.Errorf("SetValue(%q, %t) sets %t; want %t",
+				tc.param, tc.noParam, f, tc.want)
+		}
+	}
+}
+
+func TestOptionUsage(t *testing.T) {
+	tests := []struct {
+		opt  *cli.Option
+		want string
+	}{
+		{&cli.Option{Short: 'f', Shorts: []rune{'v'}, Name: "file"},
+			"-f, -v, --file"},
+		{&cli.Option{Short: 'o', Shorts: []rune{'O'}, Name: "out",
+			HasParam: true, ParamType: "file"},
+			"-O file, -o file, --out=file"},
+		{&cli.Option{Short: 'x', HasParam: true, OptionalParam: true},
+			"-x [param]"},
+		{&cli.Option{Name: "token", HasParam: true,
+			EnvVar: "FOO_TOKEN"},
+			"--token=param [$FOO_TOKEN]"},
+		{&cli.Option{Name: "token", HasParam: true,
+			EnvVar: "FOO_TOKEN", HideEnvVar: true},
+			"--token=param"},
+		{&cli.Option{Short: 'o', Name: "out", HasParam: true,
+			ParamType: "string", Placeholder: "FILE"},
+			"-o FILE, --out=FILE"},
+		{&cli.Option{Name: "since", HasParam: true, OptionalParam: true,
+			Placeholder: "DATE"},
+			"--since[=DATE]"},
+		{&cli.Option{Name: "cache", HasParam: true, ParamType: "path",
+			Default: "/var/cache/foo"},
+			"--cache=path (default /var/cache/foo)"},
+		{&cli.Option{Name: "cache", HasParam: true, ParamType: "path",
+			Default: "/var/cache/foo", HideDefault: true},
+			"--cache=path"},
+	}
+	for _, tc := range tests {
+		got := tc.opt.Usage()
+		if got != tc.want {
+			t.Errorf("Usage() returned %q; want %q", got, tc.want)
+		}
+	}
+}
+
+func TestOptionsSummary(t *testing.T) {
+	var (
+		verbose bool
+		output  string
+		dir     string
+	)
+	opts := []*cli.Option{
+		cli.BoolOption(&verbose, "verbose", 'v', "verbose output"),
+		cli.StringOption(&output, "output", 'o', "output file"),
+		cli.StringOption(&dir, "dir", 0, "directory"),
+	}
+	const want = "-v/--verbose, -o/--output, --dir"
+	if got := cli.OptionsSummary(opts); got != want {
+		t.Fatalf("OptionsSummary(opts) returned %q; want %q", got, want)
+	}
+}
+
+func TestAddOptionSet(t *testing.T) {
+	var (
+		verbose bool
+		logFile string
+		force   bool
+	)
+	logging := cli.OptionSet{
+		cli.BoolOption(&verbose, "verbose", 'v', "verbose output"),
+		cli.StringOption(&logFile, "log-file", 0, "log file"),
+	}
+
+	cmd := &cli.Command{
+		Name: "delete",
+		Options: []*cli.Option{
+			cli.BoolOption(&force, "force", 'f', "force deletion"),
+		},
+	}
+	if err := cli.AddOptionSet(cmd, logging); err != nil {
+		t.Fatalf("AddOptionSet error %s", err)
+	}
+	if len(cmd.Options) != 3 {
+		t.Fatalf("cmd has %d options; want %d", len(cmd.Options), 3)
+	}
+
+	err := cli.AddOptionSet(cmd, logging)
+	if err == nil {
+		t.Fatalf("AddOptionSet returned no error for duplicate options")
+	}
+	if !errors.Is(err, &cli.OptionError{Option: "verbose"}) {
+		t.Fatalf("AddOptionSet returned error %q", err)
+	}
+	if len(cmd.Options) != 3 {
+		t.Fatalf("cmd has %d options after error; want %d",
+			len(cmd.Options), 3)
+	}
+}
+
+func TestResetOptionsInitialValues(t *testing.T) {
+	var (
+		n   int
+		m   = 5
+		x   float64
+		str = "foo"
+	)
+	opts := []*cli.Option{
+		cli.IntOption(&n, "n", 0, "int without default"),
+		cli.IntOption(&m, "m", 0, "int with default"),
+		cli.Float64Option(&x, "x", 0, "float"),
+		cli.StringOption(&str, "str", 0, "string"),
+	}
+	args := []string{"--n=1", "--m=2", "--x=3.5", "--str=bar"}
+	if _, err := cli.ParseOptions(opts, args); err != nil {
+		t.Fatalf("ParseOptions error %s", err)
+	}
+	if err := cli.ResetOptions(opts); err != nil {
+		t.Fatalf("ResetOptions error %s", err)
+	}
+	if n != 0 || m != 5 || x != 0 || str != "foo" {
+		t.Fatalf("after reset n=%d m=%d x=%g str=%q; want %d %d %g %q",
+			n, m, x, str, 0, 5, 0.0, "foo")
+	}
+}
+
+func TestOptionValues(t *testing.T) {
+	var (
+		f   bool
+		str string
+		n   int
+		x   float64
+	)
+	opts := []*cli.Option{
+		cli.BoolOption(&f, "flag", 'f', "a boolean option"),
+		cli.StringOption(&str, "str", 's', "a string option"),
+		cli.IntOption(&n, "num", 'n', "an int option"),
+		cli.Float64Option(&x, "x", 'x', "a float option"),
+	}
+	args := []string{"-f", "--str=foo", "-n", "3", "-x", "1.5"}
+	if _, err := cli.ParseOptions(opts, args); err != nil {
+		t.Fatalf("ParseOptions error %s", err)
+	}
+
+	if b, ok := opts[0].BoolValue(); !ok || !b {
+		t.Errorf("BoolValue() returned %t, %t; want %t, %t",
+			b, ok, true, true)
+	}
+	if s, ok := opts[1].StringValue(); !ok || s != "foo" {
+		t.Errorf("StringValue() returned %q, %t; want %q, %t",
+			s, ok, "foo", true)
+	}
+	if k, ok := opts[2].IntValue(); !ok || k != 3 {
+		t.Errorf("IntValue() returned %d, %t; want %d, %t",
+			k, ok, 3, true)
+	}
+	if y, ok := opts[3].Float64Value(); !ok || y != 1.5 {
+		t.Errorf("Float64Value() returned %g, %t; want %g, %t",
+			y, ok, 1.5, true)
+	}
+	if _, ok := opts[1].IntValue(); ok {
+		t.Errorf("IntValue() of string option returned ok")
+	}
+	if v := (&cli.Option{}).Value(); v != nil {
+		t.Errorf("Value() without GetValue returned %v; want nil", v)
+	}
+}
+
+func TestUsageOptionsSharedNames(t *testing.T) {
+	var a, b bool
+	opts := []*cli.Option{
+		cli.BoolOption(&a, "alpha", 'x', "option alpha"),
+		cli.BoolOption(&b, "beta", 'x', "option beta"),
+	}
+	var sb strings.Builder
+	if _, err := cli.UsageOptions(&sb, opts, "  ", "  "); err != nil {
+		t.Fatalf("UsageOptions error %s", err)
+	}
+	s := sb.String()
+	for _, name := range []string{"--alpha", "--beta"} {
+		if k := strings.Count(s, name); k != 1 {
+			t.Errorf("%s listed %d times; want once", name, k)
+		}
+	}
+	if strings.Index(s, "--alpha") > strings.Index(s, "--beta") {
+		t.Errorf("order of options sharing a name not preserved")
+	}
+}
+
+func TestOptionsSchema(t *testing.T) {
+	var (
+		n       = 3
+		verbose bool
+		dir     string
+		format  = "text"
+	)
+	formatOpt := cli.EnumOption(&format, []string{"json", "text"},
+		"format", 0, "output format")
+	formatOpt.Required = true
+	token, user, count := "t0k3n", "root", 0
+	tokenOpt := cli.StringOption(&token, "token", 0, "access token")
+	tokenOpt.Secret = true
+	userOpt := cli.StringOption(&user, "user", 0, "user name")
+	userOpt.HideDefault = true
+	root := &cli.Command{
+		Name: "foo",
+		Info: "test program",
+		PersistentOptions: []*cli.Option{
+			cli.BoolOption(&verbose, "verbose", 'v', "verbose output"),
+		},
+		Subcommands: []*cli.Command{
+			{
+				Name: "list",
+				Options: []*cli.Option{
+					cli.IntOption(&n, "num", 'n', "number"),
+					cli.StringOption(&dir, "dir", 0,
+						"directory"),
+					formatOpt,
+					tokenOpt,
+					userOpt,
+					cli.CountOption(&count, "count", 'c',
+						"count"),
+				},
+			},
+		},
+	}
+
+	data := cli.OptionsSchema(root)
+	t.Logf("schema:\n%s", data)
+
+	var schema struct {
+		Name              string
+		PersistentOptions []struct{ Name, Type string }
+		Subcommands       []struct {
+			Name    string
+			Options []struct {
+				Name     string
+				Shorts   []string
+				Type     string
+				Required bool
+				Choices  []string
+				Default  interface{}
+			}
+		}
+	}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatalf("json.Unmarshal error %s", err)
+	}
+	if schema.Name != "foo" {
+		t.Errorf("name %q; want %q", schema.Name, "foo")
+	}
+	if o := schema.PersistentOptions[0]; o.Type != "boolean" {
+		t.Errorf("option %s has type %q; want %q",
+			o.Name, o.Type, "boolean")
+	}
+	o := schema.Subcommands[0].Options[0]
+	if o.Type != "integer" || o.Default != 3.0 || o.Shorts[0] != "n" ||
+		o.Required || o.Choices != nil {
+		t.Errorf("option %s: type %q default %v shorts %q required %t"+
+			" choices %q", o.Name, o.Type, o.Default, o.Shorts,
+			o.Required, o.Choices)
+	}
+	o = schema.Subcommands[0].Options[2]
+	if !o.Required || fmt.Sprint(o.Choices) != "[json text]" {
+		t.Errorf("option %s: required %t choices %q; want %t %q",
+			o.Name, o.Required, o.Choices, true, []string{"json", "text"})
+	}
+	for _, o := range schema.Subcommands[0].Options[3:5] {
+		if o.Default != nil {
+			t.Errorf("option %s has default %v; want none",
+				o.Name, o.Default)
+		}
+	}
+	if o = schema.Subcommands[0].Options[5]; o.Type != "integer" {
+		t.Errorf("option %s has type %q; want %q",
+			o.Name, o.Type, "integer")
+	}
+	if strings.Contains(string(data), "t0k3n") {
+		t.Errorf("schema contains the secret default")
+	}
+}
+
+func TestOptionErrorArgIndex(t *testing.T) {
+	var (
+		n     int
+		force bool
+	)
+	root := &cli.Command{
+		Name: "foo",
+		Subcommands: []*cli.Command{
+			{
+				Name: "delete",
+				Options: []*cli.Option{
+					cli.IntOption(&n, "num", 'n', "number"),
+					cli.BoolOption(&force, "force", 'f',
+						"force deletion"),
+				},
+			},
+		},
+	}
+	args := []string{"delete", "-f", "--num=x", "-f", "--bar"}
+	_, _, err := cli.Parse(root, args)
+	if err == nil {
+		t.Fatalf("Parse(root, %q) returned no error", args)
+	}
+	var oe *cli.OptionError
+	if !errors.As(err, &oe) {
+		t.Fatalf("Parse(root, %q) error %#v; want *OptionError",
+			args, err)
+	}
+	if oe.ArgIndex != 2 {
+		t.Errorf("ArgIndex is %d; want %d", oe.ArgIndex, 2)
+	}
+}
+
+func TestBytesOptions(t *testing.T) {
+	var key, iv []byte
+	opts := []*cli.Option{
+		cli.HexOption(&key, "key", 'k', "key in hex"),
+		cli.Base64Option(&iv, "iv", 0, "IV in base64"),
+	}
+	if opts[0].ParamType != "hex" || opts[1].ParamType != "base64" {
+		t.Fatalf("ParamTypes %q, %q; want %q, %q",
+			opts[0].ParamType, opts[1].ParamType, "hex", "base64")
+	}
+	args := []string{"-k", "00ff10", "--iv", "AQID"}
+	if _, err := cli.ParseOptions(opts, args); err != nil {
+		t.Fatalf("ParseOptions error %s", err)
+	}
+	if !bytes.Equal(key, []byte{0x00, 0xff, 0x10}) {
+		t.Errorf("key is %x; want %x", key, []byte{0x00, 0xff, 0x10})
+	}
+	if !bytes.Equal(iv, []byte{1, 2, 3}) {
+		t.Errorf("iv is %x; want %x", iv, []byte{1, 2, 3})
+	}
+
+	for _, args := range [][]string{
+		{"--key", "0g"},
+		{"--key", "abc"},
+		{"--iv", "AQI"},
+	} {
+		_, err := cli.ParseOptions(opts, args)
+		var oe *cli.OptionError
+		if !errors.As(err, &oe) {
+			t.Errorf("ParseOptions(%q) error %v; want OptionError",
+				args, err)
+		}
+	}
+
+	def := []byte{0xca, 0xfe}
+	if o := cli.HexOption(&def, "key", 0, ""); o.Default != "cafe" {
+		t.Errorf("Default %q; want %q", o.Default, "cafe")
+	}
+}
+
+func TestBoolGroupOption(t *testing.T) {
+	var a, b, c bool
+	members := []*cli.Option{
+		cli.BoolOption(&a, "a", 0, ""),
+		cli.BoolOption(&b, "b", 0, ""),
+		cli.BoolOption(&c, "c", 0, ""),
+	}
+	opts := append(members,
+		cli.BoolGroupOption("enable-all", 0, true, members,
+			"enables all features"),
+		cli.BoolGroupOption("disable-all", 0, false, members,
+			"disables all features"))
+
+	if _, err := cli.ParseOptions(opts, []string{"--enable-all"}); err != nil {
+		t.Fatalf("ParseOptions error %s", err)
+	}
+	if !a || !b || !c {
+		t.Fatalf("after --enable-all got %t, %t, %t; want all true",
+			a, b, c)
+	}
+	args := []string{"--disable-all", "--b"}
+	if _, err := cli.ParseOptions(opts, args); err != nil {
+		t.Fatalf("ParseOptions error %s", err)
+	}
+	if a || !b || c {
+		t.Fatalf("after %q got %t, %t, %t; want false, true, false",
+			args, a, b, c)
+	}
+
+	members[0].Required = true
+	members[1].EnvVar = "CLI_TEST_GROUP_B"
+	os.Setenv("CLI_TEST_GROUP_B", "false")
+	defer os.Unsetenv("CLI_TEST_GROUP_B")
+	if _, err := cli.ParseOptions(opts, []string{"--enable-all"}); err != nil {
+		t.Fatalf("ParseOptions error %s", err)
+	}
+	if err := cli.ApplyEnv(opts); err != nil {
+		t.Fatalf("ApplyEnv error %s", err)
+	}
+	if !b {
+		t.Fatalf("ApplyEnv overrode the group setting of b")
+	}
+
+	path := filepath.Join(t.TempDir(), "foo.conf")
+	if err := os.WriteFile(path, []byte("enable-all = false\n"), 0644); err != nil {
+		t.Fatalf("WriteFile error %s", err)
+	}
+	if err := cli.ResetOptions(opts); err != nil {
+		t.Fatalf("ResetOptions error %s", err)
+	}
+	a, b, c = true, true, true
+	if err := cli.LoadOptionsFile(opts, path); err != nil {
+		t.Fatalf("LoadOptionsFile error %s", err)
+	}
+	if a || b || c {
+		t.Fatalf("after enable-all = false got %t, %t, %t; want all false",
+			a, b, c)
+	}
+
+	for _, m := range []*cli.Option{
+		cli.IntOption(new(int), "n", 0, ""),
+		cli.CountOption(new(int), "count", 0, ""),
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("BoolGroupOption with member %s"+
+						" didn't panic", m.Name)
+				}
+			}()
+			cli.BoolGroupOption("all", 0, true, []*cli.Option{m}, "")
+		}()
+	}
+}
+
+func TestCSVOption(t *testing.T) {
+	tags := []string{"default"}
+	opt := cli.CSVOption(&tags, "tags", 't', "list of tags")
+	if opt.Default != "default" {
+		t.Fatalf("Default %q; want %q", opt.Default, "default")
+	}
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{[]string{}, []string{"default"}},
+		{[]string{"--tags", "a,b,c"}, []string{"a", "b", "c"}},
+		{[]string{"-t", "a", "-t", "b,c"}, []string{"a", "b", "c"}},
+		{[]string{"--tags", `a,"b,c"`}, []string{"a", "b,c"}},
+		{[]string{"--tags="}, []string{}},
+	}
+	opts := []*cli.Option{opt}
+	for _, tc := range tests {
+		if err := cli.ResetOptions(opts); err != nil {
+			t.Fatalf("ResetOptions error %s", err)
+		}
+		if _, err := cli.ParseOptions(opts, tc.args); err != nil {
+			t.Fatalf("ParseOptions(%q) error %s", tc.args, err)
+		}
+		if fmt.Sprintf("%q", tags) != fmt.Sprintf("%q", tc.want) {
+			t.Errorf("ParseOptions(%q) set %q; want %q",
+				tc.args, tags, tc.want)
+		}
+	}
+
+	args := []string{"--tags", `a,"b`}
+	if _, err := cli.ParseOptions(opts, args); err == nil {
+		t.Errorf("ParseOptions(%q) returned no error", args)
+	}
+}
+
+func TestMissingParamError(t *testing.T) {
+	var (
+		since string
+		n     int
+	)
+	sinceOpt := cli.StringOption(&since, "since", 's', "start date")
+	sinceOpt.ParamErrorMsg = "--since requires a date value"
+	opts := []*cli.Option{
+		sinceOpt,
+		cli.IntOption(&n, "num", 'n', "number"),
+	}
+	tests := []struct {
+		args []string
+		msg  string
+	}{
+		{[]string{"--num"}, "option --num requires a parameter"},
+		{[]string{"-n"}, "option -n requires a parameter"},
+		{[]string{"--since"}, "--since requires a date value"},
+		{[]string{"-s"}, "--since requires a date value"},
+	}
+	for _, tc := range tests {
+		_, err := cli.ParseOptions(opts, tc.args)
+		if err == nil || err.Error() != tc.msg {
+			t.Errorf("ParseOptions(%q) error %v; want %q",
+				tc.args, err, tc.msg)
+		}
+	}
+}
+
+func TestExperimentalOption(t *testing.T) {
+	var (
+		fast    bool
+		verbose bool
+	)
+	fastOpt := cli.BoolOption(&fast, "fast", 'F', "experimental mode")
+	fastOpt.Experimental = true
+	opts := []*cli.Option{
+		fastOpt,
+		cli.BoolOption(&verbose, "verbose", 'v', ""),
+	}
+
+	env := cli.ExperimentalEnv
+	cli.ExperimentalEnv = "FOO_ENABLE_EXPERIMENTAL"
+	defer func() { cli.ExperimentalEnv = env }()
+	os.Unsetenv("FOO_ENABLE_EXPERIMENTAL")
+
+	for _, args := range [][]string{{"--fast"}, {"-vF"}} {
+		_, err := cli.ParseOptions(opts, args)
+		if !errors.Is(err, &cli.OptionError{Option: "fast"}) &&
+			!errors.Is(err, &cli.OptionError{Option: "F"}) {
+			t.Fatalf("ParseOptions(%q) error %v; want experimental error",
+				args, err)
+		}
+		if !strings.Contains(err.Error(), "set FOO_ENABLE_EXPERIMENTAL=1") {
+			t.Errorf("error %q doesn't explain how to enable", err)
+		}
+	}
+	var sb strings.Builder
+	if _, err := cli.UsageOptions(&sb, opts, "  ", "  "); err != nil {
+		t.Fatalf("UsageOptions error %s", err)
+	}
+	if strings.Contains(sb.String(), "fast") {
+		t.Errorf("usage lists experimental option:\n%s", sb.String())
+	}
+
+	os.Setenv("FOO_ENABLE_EXPERIMENTAL", "1")
+	defer os.Unsetenv("FOO_ENABLE_EXPERIMENTAL")
+	if _, err := cli.ParseOptions(opts, []string{"--fast"}); err != nil {
+		t.Fatalf("ParseOptions error %s", err)
+	}
+	if !fast {
+		t.Errorf("enabled experimental option not set")
+	}
+	sb.Reset()
+	if _, err := cli.UsageOptions(&sb, opts, "  ", "  "); err != nil {
+		t.Fatalf("UsageOptions error %s", err)
+	}
+	if !strings.Contains(sb.String(), "fast") {
+		t.Errorf("usage doesn't list enabled option:\n%s", sb.String())
+	}
+}
+
+func TestOptionTransform(t *testing.T) {
+	var level string
+	opt := cli.StringOption(&level, "level", 'l', "log level")
+	opt.Transform = func(s string) string {
+		return strings.ToLower(strings.TrimSpace(s))
+	}
+	opts := []*cli.Option{opt}
+	for _, args := range [][]string{
+		{"--level", " WARN "},
+		{"--level=Warn"},
+		{"-l", "wArN"},
+	} {
+		level = ""
+		if _, err := cli.ParseOptions(opts, args); err != nil {
+			t.Fatalf("ParseOptions(%q) error %s", args, err)
+		}
+		if level != "warn" {
+			t.Errorf("ParseOptions(%q) set %q; want %q",
+				args, level, "warn")
+		}
+	}
+}
+
+func TestPathOption(t *testing.T) {
+	switch runtime.GOOS {
+	case "windows", "plan9":
+		t.Skip("home directory is not taken from $HOME on " + runtime.GOOS)
+	}
+	home, hasHome := os.LookupEnv("HOME")
+	defer func() {
+		if hasHome {
+			os.Setenv("HOME", home)
+		} else {
+			os.Unsetenv("HOME")
+		}
+	}()
+	os.Setenv("HOME", "/home/user")
+	os.Setenv("FOO_DIR", "/srv/foo")
+	defer os.Unsetenv("FOO_DIR")
+
+	var path string
+	opt := cli.PathOption(&path, "config", 'c', "config file")
+	if opt.ParamType != "path" {
+		t.Fatalf("ParamType %q; want %q", opt.ParamType, "path")
+	}
+	opts := []*cli.Option{opt}
+	tests := []struct {
+		param string
+		want  string
+	}{
+		{"~/.foorc", "/home/user/.foorc"},
+		{"~", "/home/user"},
+		{"$FOO_DIR/config", "/srv/foo/config"},
+		{"${FOO_DIR}/config", "/srv/foo/config"},
+		{"~/$FOO_DIR", "/home/user//srv/foo"},
+		{"~other/x", "~other/x"},
+		{"a~/b", "a~/b"},
+	}
+	for _, tc := range tests {
+		if _, err := cli.ParseOptions(opts, []string{"-c", tc.param}); err != nil {
+			t.Fatalf("ParseOptions error %s", err)
+		}
+		if path != tc.want {
+			t.Errorf("-c %q set %q; want %q", tc.param, path, tc.want)
+		}
+	}
+
+	os.Unsetenv("HOME")
+	if p := cli.ExpandPath("~/x"); p != "~/x" {
+		t.Errorf("ExpandPath without HOME returned %q; want %q", p, "~/x")
+	}
+}
+
+func TestBuildCommand(t *testing.T) {
+	spec := []byte(`{
+  "name": "foo",
+  "info": "test program",
+  "persistentOptions": [
+    {"name": "verbose", "shorts": ["v"], "type": "boolean"}
+  ],
+  "subcommands": [
+    {
+      "name": "list",
+      "names": ["ls"],
+      "options": [
+        {"name": "num", "shorts": ["n", "N"], "type": "integer",
+         "paramType": "int", "default": 3},
+        {"name": "scale", "type": "number", "paramType": "float64"},
+        {"name": "dir", "type": "string", "paramType": "path",
+         "default": "/tmp"},
+        {"name": "sort", "type": "string", "choices": ["name", "size"],
+         "required": true, "default": "name"}
+      ]
+    }
+  ]
+}`)
+	root, err := cli.BuildCommand(spec)
+	if err != nil {
+		t.Fatalf("BuildCommand error %s", err)
+	}
+	data := cli.OptionsSchema(root)
+	root2, err := cli.BuildCommand(data)
+	if err != nil {
+		t.Fatalf("BuildCommand of schema error %s", err)
+	}
+	if data2 := cli.OptionsSchema(root2); !bytes.Equal(data, data2) {
+		t.Fatalf("schema changed by round trip:\n%s\n%s", data, data2)
+	}
+
+	_, _, err = cli.Parse(root, []string{"ls", "--sort", "date"})
+	if !errors.Is(err, &cli.OptionError{Option: "sort"}) {
+		t.Fatalf("Parse(--sort date) error %v; want invalid value", err)
+	}
+	_, _, err = cli.Parse(root, []string{"ls"})
+	if !errors.Is(err, &cli.OptionError{Option: "sort"}) {
+		t.Fatalf("Parse without --sort error %v; want required", err)
+	}
+
+	var args []string
+	commands, _, err := cli.Parse(root, []string{"-v", "ls", "-N", "7",
+		"--scale", "0.5", "--sort", "size"})
+	if err != nil {
+		t.Fatalf("Parse error %s", err)
+	}
+	list := commands[len(commands)-1]
+	list.Exec = func(a []string) error { args = a; return nil }
+	if list.Name != "list" {
+		t.Fatalf("Parse selected %q; want %q", list.Name, "list")
+	}
+	if b, _ := root.PersistentOptions[0].BoolValue(); !b {
+		t.Errorf("verbose not set")
+	}
+	if n, _ := list.Options[0].IntValue(); n != 7 {
+		t.Errorf("num is %d; want %d", n, 7)
+	}
+	if x, _ := list.Options[1].Float64Value(); x != 0.5 {
+		t.Errorf("scale is %g; want %g", x, 0.5)
+	}
+	if s, _ := list.Options[2].StringValue(); s != "/tmp" {
+		t.Errorf("dir is %q; want %q", s, "/tmp")
+	}
+	if err = cli.Run(root, []string{"list", "--sort=name", "a"}); err != nil {
+		t.Fatalf("Run error %s", err)
+	}
+	if len(args) != 1 || args[0] != "a" {
+		t.Errorf("Exec got args %q; want %q", args, []string{"a"})
+	}
+
+	for _, spec := range []string{
+		`{"name": "foo", "options": [{"name": "x", "type": "array"}]}`,
+		`{"name": "foo", "options": [{"name": "x", "type": "integer",
+		  "default": "3"}]}`,
+		`{"name": "foo", "options": [{"shorts": ["xy"],
+		  "type": "boolean"}]}`,
+		`{"info": "no name"}`,
+	} {
+		if _, err := cli.BuildCommand([]byte(spec)); err == nil {
+			t.Errorf("BuildCommand(%s) returned no error", spec)
+		}
+	}
+}
+
+func TestBuildCommandTypes(t *testing.T) {
+	spec := []byte(`{
+  "name": "foo",
+  "options": [
+    {"name": "count", "type": "integer", "paramType": "uint",
+     "default": 2},
+    {"name": "offset", "type": "integer", "paramType": "int64",
+     "default": -5},
+    {"name": "size", "type": "integer", "paramType": "uint64"},
+    {"name": "color", "type": "boolean", "default": true},
+    {"name": "quiet", "type": "boolean", "default": false},
+    {"name": "verbose", "type": "integer"}
+  ]
+}`)
+	root, err := cli.BuildCommand(spec)
+	if err != nil {
+		t.Fatalf("BuildCommand error %s", err)
+	}
+	values := func() string {
+		var sb strings.Builder
+		for _, o := range root.Options {
+			fmt.Fprintf(&sb, "%s=%v(%T) ", o.Name, o.Value(), o.Value())
+		}
+		return sb.String()
+	}
+	const defaults = "count=2(uint) offset=-5(int64) size=0(uint64)" +
+		" color=true(bool) quiet=false(bool) verbose=0(int) "
+	if got := values(); got != defaults {
+		t.Fatalf("values %q; want %q", got, defaults)
+	}
+
+	root.LenientBooleans = true
+	if _, _, err = cli.Parse(root, []string{"--count=-1"}); err == nil {
+		t.Fatalf("Parse(--count=-1) returned no error")
+	}
+	args := []string{"--size=18446744073709551615", "--offset=-9000000000",
+		"--color=false", "--verbose", "--verbose"}
+	if _, _, err = cli.Parse(root, args); err != nil {
+		t.Fatalf("Parse(%q) error %s", args, err)
+	}
+	const set = "count=2(uint) offset=-9000000000(int64)" +
+		" size=18446744073709551615(uint64) color=false(bool)" +
+		" quiet=false(bool) verbose=2(int) "
+	if got := values(); got != set {
+		t.Fatalf("values %q; want %q", got, set)
+	}
+	if err = cli.ResetOptions(root.Options); err != nil {
+		t.Fatalf("ResetOptions error %s", err)
+	}
+	if got := values(); got != defaults {
+		t.Fatalf("values after reset %q; want %q", got, defaults)
+	}
+
+	for _, spec := range []string{
+		`{"name": "foo", "options": [{"name": "x", "type": "integer",
+		  "paramType": "uint", "default": -1}]}`,
+		`{"name": "foo", "options": [{"name": "x", "type": "integer",
+		  "default": 1.5}]}`,
+		`{"name": "foo", "options": [{"name": "x", "type": "boolean",
+		  "default": "yes"}]}`,
+	} {
+		if _, err := cli.BuildCommand([]byte(spec)); err == nil {
+			t.Errorf("BuildCommand(%s) returned no error", spec)
+		}
+	}
+}
+
+func TestShortFlagWithEquals(t *testing.T) {
+	var (
+		help    bool
+		verbose bool
+		name    string
+	)
+	opts := []*cli.Option{
+		cli.BoolOption(&help, "help", 'h', ""),
+		cli.BoolOption(&verbose, "verbose", 'v', ""),
+		cli.StringOption(&name, "name", 'n', ""),
+	}
+	tests := []struct {
+		args   []string
+		option string
+		msg    string
+	}{
+		{[]string{"-h=foo"}, "h", "option -h takes no parameter"},
+		{[]string{"-vh=foo"}, "h", "option -h takes no parameter"},
+		{[]string{"--help=foo"}, "help", "option --help takes no parameter"},
+	}
+	for _, tc := range tests {
+		_, err := cli.ParseOptions(opts, tc.args)
+		if !errors.Is(err, &cli.OptionError{Option: tc.option}) ||
+			err.Error() != tc.msg {
+			t.Errorf("ParseOptions(%q) error %v; want %q",
+				tc.args, err, tc.msg)
+		}
+	}
+
+	if _, err := cli.ParseOptions(opts, []string{"-vn", "x"}); err != nil {
+		t.Fatalf("ParseOptions error %s", err)
+	}
+	if !verbose || name != "x" {
+		t.Errorf("got verbose=%t name=%q; want true, %q", verbose, name, "x")
+	}
+}
+
+func TestOptString(t *testing.T) {
+	var (
+		help, verbose bool
+		out, file     string
+		level         int
+	)
+	levelOpt := cli.IntOption(&level, "level", 'l', "")
+	levelOpt.OptionalParam = true
+	opts := []*cli.Option{
+		cli.BoolOption(&help, "help", 'h', ""),
+		cli.BoolOption(&verbose, "verbose", 'v', ""),
+		cli.StringOption(&out, "out", 'o', ""),
+		cli.StringOption(&file, "file", 'f', ""),
+		levelOpt,
+		cli.BoolOption(new(bool), "long-only", 0, ""),
+	}
+	const want = "hvo:f:l::"
+	if s := cli.OptString(opts); s != want {
+		t.Fatalf("OptString returned %q; want %q", s, want)
+	}
+}
+
+func TestTimeOption(t *testing.T) {
+	now := cli.Now
+	defer func() { cli.Now = now }()
+	clock := time.Date(2024, 5, 6, 12, 0, 0, 0, time.UTC)
+	cli.Now = func() time.Time { return clock }
+
+	since := cli.Now().Add(-time.Hour)
+	opt := cli.TimeOption(&since, "since", 's', "start time")
+	if opt.Default != "2024-05-06T11:00:00Z" {
+		t.Fatalf("Default %q; want %q", opt.Default, "2024-05-06T11:00:00Z")
+	}
+	opts := []*cli.Option{opt}
+	tests := []struct {
+		param string
+		want  time.Time
+	}{
+		{"-30m", clock.Add(-30 * time.Minute)},
+		{"2h", clock.Add(2 * time.Hour)},
+		{"2023-01-02T03:04:05Z", time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)},
+	}
+	for _, tc := range tests {
+		args := []string{"--since=" + tc.param}
+		if _, err := cli.ParseOptions(opts, args); err != nil {
+			t.Fatalf("ParseOptions(%q) error %s", args, err)
+		}
+		if !since.Equal(tc.want) {
+			t.Errorf("%q set %s; want %s", args, since, tc.want)
+		}
+	}
+	if _, err := cli.ParseOptions(opts, []string{"-s", "yesterday"}); err == nil {
+		t.Errorf("ParseOptions(-s yesterday) returned no error")
+	}
+}
+
+func TestParseOptionsStopOnFirstError(t *testing.T) {
+	var (
+		n   int
+		str string
+	)
+	options := []*cli.Option{
+		cli.IntOption(&n, "num", 'n', "number"),
+		cli.StringOption(&str, "str", 's', "string"),
+	}
+	args := []string{"--num=x", "--str=foo", "--num=y"}
+
+	_, err := cli.ParseOptions(options, args)
+	if k := len(cli.Errors(err)); k != 2 {
+		t.Fatalf("ParseOptions(%q) returned %d errors; want %d",
+			args, k, 2)
+	}
+	if str != "foo" {
+		t.Fatalf("str is %q; want %q", str, "foo")
+	}
+
+	str = ""
+	used, err := cli.ParseOptions(options, args, cli.StopOnFirstError)
+	if k := len(cli.Errors(err)); k != 1 {
+		t.Fatalf("ParseOptions(%q, StopOnFirstError) returned %d"+
+			" errors; want %d", args, k, 1)
+	}
+	if !errors.Is(err, &cli.OptionError{Option: "num"}) {
+		t.Fatalf("ParseOptions error %v; want error for num", err)
+	}
+	if str != "" {
+		t.Fatalf("str is %q; want %q", str, "")
+	}
+	if used != 1 {
+		t.Fatalf("ParseOptions returned n=%d; want %d", used, 1)
+	}
+}
+
+func TestRequiredOption(t *testing.T) {
+	var output string
+	outOpt := cli.StringOption(&output, "output", 'o', "output file")
+	outOpt.Required = true
+	outOpt.Default = "a.out"
+	options := []*cli.Option{outOpt}
+
+	_, err := cli.ParseOptions(options, []string{"file"})
+	if err == nil {
+		t.Fatalf("ParseOptions without --output returned no error")
+	}
+	if !errors.Is(err, &cli.OptionError{Option: "output"}) {
+		t.Fatalf("errors.Is(%v, --output) returned false", err)
+	}
+	const msg = "required option --output not set"
+	if err.Error() != msg {
+		t.Fatalf("got error %q; want %q", err, msg)
+	}
+
+	if _, err = cli.ParseOptions(options, []string{"-o", "b.out"}); err != nil {
+		t.Fatalf("ParseOptions error %s", err)
+	}
+	if err = cli.ResetOptions(options); err != nil {
+		t.Fatalf("ResetOptions error %s", err)
+	}
+	if _, err = cli.ParseOptions(options, nil); err == nil {
+		t.Fatalf("ParseOptions after ResetOptions returned no error")
+	}
+}
+
+func TestRequiredOptionRunTwice(t *testing.T) {
+	var output string
+	outOpt := cli.StringOption(&output, "out", 0, "output file")
+	outOpt.Required = true
+	executed := false
+	root := &cli.Command{
+		Name:    "foo",
+		Options: []*cli.Option{outOpt},
+		Subcommands: []*cli.Command{
+			{Name: "bar", Exec: func(args []string) error {
+				return nil
+			}},
+		},
+		Exec: func(args []string) error {
+			executed = true
+			return nil
+		},
+	}
+	cli.AddHelpOption(root)
+
+	if err := cli.Run(root, []string{"--out=x"}); err != nil {
+		t.Fatalf("Run(--out=x) error %s", err)
+	}
+	executed = false
+	err := cli.Run(root, nil)
+	if !errors.Is(err, &cli.OptionError{Option: "out"}) {
+		t.Fatalf("second Run error %v; want required option --out", err)
+	}
+	if executed {
+		t.Fatalf("second Run executed the command")
+	}
+
+	if _, err = captureStdout(t, func() error {
+		return cli.Run(root, []string{"-h"})
+	}); err != nil {
+		t.Fatalf("Run(-h) error %s", err)
+	}
+	out, err := captureStdout(t, func() error {
+		return cli.Run(root, []string{"--out=x"})
+	})
+	if err != nil {
+		t.Fatalf("Run(--out=x) after -h error %s", err)
+	}
+	if !executed || out != "" {
+		t.Fatalf("Run(--out=x) after -h printed %q; want execution", out)
+	}
+}
+
+func TestRequiredOptionParse(t *testing.T) {
+	var token, output string
+	tokenOpt := cli.StringOption(&token, "token", 0, "access token")
+	tokenOpt.Required = true
+	outOpt := cli.StringOption(&output, "output", 0, "output file")
+	outOpt.Required = true
+	exec := func(args []string) error { return nil }
+	newRoot := func() *cli.Command {
+		tokenOpt.Reset()
+		outOpt.Reset()
+		root := &cli.Command{
+			Name:              "foo",
+			PersistentOptions: []*cli.Option{tokenOpt},
+			Subcommands: []*cli.Command{
+				{
+					Name:    "bar",
+					Options: []*cli.Option{outOpt},
+					Exec:    exec,
+				},
+				{Name: "baz", Exec: exec},
+			},
+		}
+		cli.AddHelpCommand(root)
+		cli.AddHelpOptionToAll(root)
+		return root
+	}
+
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"--token", "t", "bar", "--output", "o"}, nil},
+		{[]string{"bar", "--token", "t", "--output", "o"}, nil},
+		{[]string{"--token", "t", "baz"}, nil},
+		{[]string{"bar", "--output", "o"}, []string{"token"}},
+		{[]string{"--token", "t", "bar"}, []string{"output"}},
+		{[]string{"bar"}, []string{"token", "output"}},
+		{[]string{"bar", "-h"}, nil},
+		{[]string{"help", "bar"}, nil},
+	}
+	for _, tc := range tests {
+		root := newRoot()
+		_, err := captureStdout(t, func() error {
+			return cli.Run(root, tc.args)
+		})
+		if len(tc.want) == 0 {
+			if err != nil {
+				t.Errorf("Run(%q) error %s", tc.args, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("Run(%q) returned no error", tc.args)
+			continue
+		}
+		for _, name := range tc.want {
+			if !errors.Is(err, &cli.OptionError{Option: name}) {
+				t.Errorf("Run(%q) error %q doesn't report %s",
+					tc.args, err, name)
+			}
+		}
+	}
+}
+
+func TestIntegerOptions(t *testing.T) {
+	var (
+		i64 int64
+		u   uint
+		u64 uint64 = 42
+	)
+	options := []*cli.Option{
+		cli.Int64Option(&i64, "i64", 0, ""),
+		cli.UintOption(&u, "uint", 0, ""),
+		cli.Uint64Option(&u64, "u64", 0, ""),
+	}
+	wantTypes := []string{"int64", "uint", "uint64"}
+	wantDefaults := []string{"", "", "42"}
+	for i, o := range options {
+		if o.ParamType != wantTypes[i] {
+			t.Errorf("option %s has ParamType %q; want %q",
+				o.Name, o.ParamType, wantTypes[i])
+		}
+		if o.Default != wantDefaults[i] {
+			t.Errorf("option %s has Default %q; want %q",
+				o.Name, o.Default, wantDefaults[i])
+		}
+	}
+
+	tests := []struct {
+		arg   string
+		value interface{}
+		err   bool
+	}{
+		{"--i64=9223372036854775807", int64(9223372036854775807), false},
+		{"--i64=-9223372036854775808", int64(-9223372036854775808), false},
+		{"--i64=9223372036854775808", nil, true},
+		{"--i64=0x7f", int64(127), false},
+		{"--i64=-0b101", int64(-5), false},
+		{"--i64=017", int64(15), false},
+		{"--uint=0xff", uint(255), false},
+		{"--uint=0b11", uint(3), false},
+		{"--uint=-1", nil, true},
+		{"--uint=abc", nil, true},
+		{"--u64=18446744073709551615", uint64(18446744073709551615), false},
+		{"--u64=18446744073709551616", nil, true},
+		{"--u64=0o17", uint64(15), false},
+		{"--u64=-0", nil, true},
+	}
+	for _, tc := range tests {
+		if err := cli.ResetOptions(options); err != nil {
+			t.Fatalf("ResetOptions error %s", err)
+		}
+		_, err := cli.ParseOptions(options, []string{tc.arg})
+		if tc.err {
+			var oe *cli.OptionError
+			if !errors.As(err, &oe) {
+				t.Errorf("ParseOptions(%q) error %v; want OptionError",
+					tc.arg, err)
+			} else if oe.Wrapped == nil {
+				t.Errorf("ParseOptions(%q) error %v wraps no error",
+					tc.arg, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseOptions(%q) error %s", tc.arg, err)
+			continue
+		}
+		name := tc.arg[2:strings.IndexByte(tc.arg, '=')]
+		for _, o := range options {
+			if o.Name == name && o.Value() != tc.value {
+				t.Errorf("ParseOptions(%q) set %v; want %v",
+					tc.arg, o.Value(), tc.value)
+			}
+		}
+	}
+	if u64 != 42 {
+		t.Errorf("u64 is %d after reset; want %d", u64, 42)
+	}
+}
+
+func TestRequireEquals(t *testing.T) {
+	var (
+		output string
+		color  string
+	)
+	outOpt := cli.StringOption(&output, "output", 'o', "output file")
+	outOpt.RequireEquals = true
+	colorOpt := cli.StringOption(&color, "color", 0, "colorize output")
+	colorOpt.OptionalParam = true
+	colorOpt.RequireEquals = true
+	options := []*cli.Option{outOpt, colorOpt}
+
+	tests := []struct {
+		args   []string
+		n      int
+		output string
+		color  string
+		err    string
+	}{
+		{args: []string{"--output=a.out", "file"}, n: 1,
+			output: "a.out"},
+		{args: []string{"-o", "a.out", "file"}, n: 2, output: "a.out"},
+		{args: []string{"--output", "file"},
+			err: "option --output requires a parameter" +
+				" in the form --output=value"},
+		{args: []string{"--color", "file"}, n: 1},
+		{args: []string{"--color=always", "file"}, n: 1,
+			color: "always"},
+	}
+	for _, tc := range tests {
+		if err := cli.ResetOptions(options); err != nil {
+			t.Fatalf("ResetOptions error %s", err)
+		}
+		n, err := cli.ParseOptions(options, tc.args)
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("ParseOptions(%q) error %v; want %q",
+					tc.args, err, tc.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseOptions(%q) error %s", tc.args, err)
+			continue
+		}
+		if n != tc.n {
+			t.Errorf("ParseOptions(%q) returned n=%d; want %d",
+				tc.args, n, tc.n)
+		}
+		if output != tc.output || color != tc.color {
+			t.Errorf("ParseOptions(%q) set output=%q color=%q;"+
+				" want %q and %q",
+				tc.args, output, color, tc.output, tc.color)
+		}
+	}
+}
+
+func TestStringSliceOption(t *testing.T) {
+	dirs := []string{"preset"}
+	opt := cli.StringSliceOption(&dirs, "include", 'I', "include directory")
+	if len(dirs) != 0 {
+		t.Fatalf("dirs is %q after construction; want empty", dirs)
+	}
+	const usage = "-I string, --include=string ..."
+	if got := opt.Usage(); got != usage {
+		t.Fatalf("Usage returns %q; want %q", got, usage)
+	}
+	options := []*cli.Option{opt}
+
+	args := []string{"-I", "/usr/include", "--include=/opt/include",
+		"-I", "/usr/local/include", "--include", "b", "file"}
+	n, err := cli.ParseOptions(options, args)
+	if err != nil {
+		t.Fatalf("ParseOptions error %s", err)
+	}
+	if n != len(args)-1 {
+		t.Fatalf("ParseOptions returned n=%d; want %d", n, len(args)-1)
+	}
+	want := []string{"/usr/include", "/opt/include", "/usr/local/include",
+		"b"}
+	if fmt.Sprint(dirs) != fmt.Sprint(want) {
+		t.Fatalf("dirs is %q; want %q", dirs, want)
+	}
+
+	if err = cli.ResetOptions(options); err != nil {
+		t.Fatalf("ResetOptions error %s", err)
+	}
+	if len(dirs) != 0 {
+		t.Fatalf("dirs is %q after reset; want empty", dirs)
+	}
+}
+
+func TestOptionLog(t *testing.T) {
+	var defines, undefs []string
+	var verbose int
+	options := []*cli.Option{
+		cli.StringSliceOption(&defines, "define", 'D', ""),
+		cli.StringSliceOption(&undefs, "undef", 'U', ""),
+		cli.CountOption(&verbose, "verbose", 'v', ""),
+	}
+	var log cli.OptionLog
+	log.Record(options...)
+
+	args := []string{"--define", "A", "-v", "--undef", "B", "-D", "C",
+		"-vU", "D"}
+	if _, err := cli.ParseOptions(options, args); err != nil {
+		t.Fatalf("ParseOptions error %s", err)
+	}
+	if fmt.Sprint(defines) != "[A C]" || fmt.Sprint(undefs) != "[B D]" {
+		t.Fatalf("defines %q undefs %q; want [A C] and [B D]",
+			defines, undefs)
+	}
+	var got []string
+	for _, e := range log.Events() {
+		s := e.Option.Name
+		if !e.NoParam {
+			s += "=" + e.Param
+		}
+		got = append(got, s)
+	}
+	want := []string{"define=A", "verbose", "undef=B", "define=C",
+		"verbose", "undef=D"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("events %q; want %q", got, want)
+	}
+
+	if err := cli.ResetOptions(options); err != nil {
+		t.Fatalf("ResetOptions error %s", err)
+	}
+	if n := len(log.Events()); n != len(want) {
+		t.Fatalf("ResetOptions changed the number of events to %d", n)
+	}
+	log.Reset()
+	if n := len(log.Events()); n != 0 {
+		t.Fatalf("log has %d events after Reset; want 0", n)
+	}
+}
+
+func TestEnumOption(t *testing.T) {
+	format := "text"
+	opt := cli.EnumOption(&format, []string{"json", "yaml", "text"},
+		"format", 'f', "output format")
+	if opt.ParamType != "(json|yaml|text)" {
+		t.Fatalf("ParamType is %q; want %q", opt.ParamType,
+			"(json|yaml|text)")
+	}
+	const usage = "-f (json|yaml|text), --format=(json|yaml|text)" +
+		" (default text)"
+	if got := opt.Usage(); got != usage {
+		t.Fatalf("Usage returns %q; want %q", got, usage)
+	}
+	options := []*cli.Option{opt}
+
+	if _, err := cli.ParseOptions(options, []string{"--format=yaml"}); err != nil {
+		t.Fatalf("ParseOptions error %s", err)
+	}
+	if format != "yaml" {
+		t.Fatalf("format is %q; want %q", format, "yaml")
+	}
+
+	_, err := cli.ParseOptions(options, []string{"-f", "xml"})
+	var oe *cli.OptionError
+	if !errors.As(err, &oe) || oe.Wrapped == nil {
+		t.Fatalf("ParseOptions error %v; want wrapped OptionError", err)
+	}
+	if !strings.Contains(err.Error(), "valid values are json, yaml, text") {
+		t.Fatalf("error %q doesn't list the valid values", err)
+	}
+	if format != "yaml" {
+		t.Fatalf("format is %q after error; want %q", format, "yaml")
+	}
+
+	if err = cli.ResetOptions(options); err != nil {
+		t.Fatalf("ResetOptions error %s", err)
+	}
+	if format != "text" {
+		t.Fatalf("format is %q after reset; want %q", format, "text")
+	}
+}
+
+func TestValueAliases(t *testing.T) {
+	level := "info"
+	opt := cli.EnumOption(&level, []string{"info", "warning", "error"},
+		"level", 'l', "log level")
+	opt.ValueAliases = map[string]string{"warn": "warning", "err": "error"}
+	opt.Transform = strings.ToLower
+	const usage = "-l (info|warning|error), --level=(info|warning|error)" +
+		" (default info)"
+	if got := opt.Usage(); got != usage {
+		t.Fatalf("Usage returns %q; want %q", got, usage)
+	}
+	options := []*cli.Option{opt}
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"--level", "warn"}, "warning"},
+		{[]string{"--level=warning"}, "warning"},
+		{[]string{"-l", "ERR"}, "error"},
+		{[]string{"-l", "info"}, "info"},
+	}
+	for _, tc := range tests {
+		if _, err := cli.ParseOptions(options, tc.args); err != nil {
+			t.Fatalf("ParseOptions(%q) error %s", tc.args, err)
+		}
+		if level != tc.want {
+			t.Fatalf("ParseOptions(%q): level is %q; want %q",
+				tc.args, level, tc.want)
+		}
+	}
+}
+
+func TestCountOption(t *testing.T) {
+	n := 5
+	opt := cli.CountOption(&n, "verbose", 'v', "increases verbosity")
+	if opt.HasParam {
+		t.Fatalf("CountOption has a parameter")
+	}
+	if n != 0 {
+		t.Fatalf("n is %d after construction; want %d", n, 0)
+	}
+	options := []*cli.Option{opt}
+
+	tests := []struct {
+		args []string
+		want int
+	}{
+		{[]string{"-v"}, 1},
+		{[]string{"-vvv"}, 3},
+		{[]string{"--verbose", "--verbose"}, 2},
+		{[]string{"-vv", "--verbose", "-v"}, 4},
+		{nil, 0},
+	}
+	for _, tc := range tests {
+		if err := cli.ResetOptions(options); err != nil {
+			t.Fatalf("ResetOptions error %s", err)
+		}
+		if _, err := cli.ParseOptions(options, tc.args); err != nil {
+			t.Fatalf("ParseOptions(%q) error %s", tc.args, err)
+		}
+		if n != tc.want {
+			t.Errorf("ParseOptions(%q) set n to %d; want %d",
+				tc.args, n, tc.want)
+		}
+	}
+}
+
+func TestNegatableBoolOption(t *testing.T) {
+	var color bool
+	opt := cli.NegatableBoolOption(&color, "color", 'c', "colorize output")
+	const usage = "-c, --[no-]color"
+	if got := opt.Usage(); got != usage {
+		t.Fatalf("Usage returns %q; want %q", got, usage)
+	}
+	options := []*cli.Option{opt}
+
+	tests := []struct {
+		args []string
+		want bool
+		err  bool
+	}{
+		{args: []string{"--color"}, want: true},
+		{args: []string{"--no-color"}, want: false},
+		{args: []string{"--color", "--no-color"}, want: false},
+		{args: []string{"--no-color", "--color"}, want: true},
+		{args: []string{"--no-col"}, want: false},
+		{args: []string{"-c"}, want: true},
+		{args: []string{"--no-"}, err: true},
+		{args: []string{"--no-color=true"}, err: true},
+		{args: []string{"-no-color"}, err: true},
+	}
+	for _, tc := range tests {
+		if err := cli.ResetOptions(options); err != nil {
+			t.Fatalf("ResetOptions error %s", err)
+		}
+		color = !tc.want
+		_, err := cli.ParseOptions(options, tc.args)
+		if tc.err {
+			if err == nil {
+				t.Errorf("ParseOptions(%q) returned no error",
+					tc.args)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseOptions(%q) error %s", tc.args, err)
+			continue
+		}
+		if color != tc.want {
+			t.Errorf("ParseOptions(%q) set color to %t; want %t",
+				tc.args, color, tc.want)
+		}
+	}
+
+	color = true
+	if err := cli.ResetOptions(options); err != nil {
+		t.Fatalf("ResetOptions error %s", err)
+	}
+	if color {
+		t.Fatalf("color is true after reset")
+	}
+}
+
+func TestImmediateOption(t *testing.T) {
+	var (
+		output  string
+		verbose bool
+		shown   int
+	)
+	outOpt := cli.StringOption(&output, "output", 'o', "output file")
+	outOpt.Required = true
+	showOpt := &cli.Option{
+		Name:      "show",
+		Short:     's',
+		Immediate: true,
+		SetValue: func(name, param string, noParam bool) error {
+			shown++
+			return nil
+		},
+		ResetValue: func() {},
+	}
+	options := []*cli.Option{
+		outOpt, showOpt, cli.BoolOption(&verbose, "verbose", 'v', ""),
+	}
+
+	tests := []struct {
+		args []string
+		n    int
+	}{
+		{[]string{"--show"}, 1},
+		{[]string{"-v", "--show", "-v", "file"}, 2},
+		{[]string{"-vsv", "file"}, 1},
+		{[]string{"--bogus", "-s", "--bogus"}, 2},
+	}
+	for _, tc := range tests {
+		if err := cli.ResetOptions(options); err != nil {
+			t.Fatalf("ResetOptions error %s", err)
+		}
+		shown = 0
+		n, err := cli.ParseOptions(options, tc.args)
+		if err != cli.ErrImmediate {
+			t.Errorf("ParseOptions(%q) error %v; want ErrImmediate",
+				tc.args, err)
+		}
+		if n != tc.n {
+			t.Errorf("ParseOptions(%q) returned n=%d; want %d",
+				tc.args, n, tc.n)
+		}
+		if shown != 1 {
+			t.Errorf("ParseOptions(%q) called SetValue %d times",
+				tc.args, shown)
+		}
+	}
+
+	root := &cli.Command{
+		Name:    "foo",
+		Options: options,
+		Exec: func(args []string) error {
+			t.Fatalf("Exec called")
+			return nil
+		},
+	}
+	code, err := cli.RunCode(root, []string{"--show", "-v"})
+	if code != cli.ExitOK || err != nil {
+		t.Fatalf("RunCode returned %d, %v; want %d, nil", code, err,
+			cli.ExitOK)
+	}
+}
+
+func TestQuantityOption(t *testing.T) {
+	timeout := 30.0
+	units := map[string]float64{"ms": 1e-3, "s": 1, "m": 60, "h": 3600}
+	opt := cli.QuantityOption(&timeout, units, "timeout", 't', "timeout")
+	if opt.Default != "30" {
+		t.Fatalf("Default is %q; want %q", opt.Default, "30")
+	}
+	options := []*cli.Option{opt}
+
+	tests := []struct {
+		arg  string
+		want float64
+		err  string
+	}{
+		{arg: "500ms", want: 0.5},
+		{arg: "2m", want: 120},
+		{arg: "1.5h", want: 5400},
+		{arg: "1e3ms", want: 1},
+		{arg: "10 s", want: 10},
+		{arg: "45", want: 45},
+		{arg: "-2s", want: -2},
+		{arg: "5mn", err: `unknown unit "mn"; valid units are h, m, ms, s`},
+		{arg: "5hr", err: `did you mean "h"?`},
+		{arg: "ms", err: "invalid quantity"},
+		{arg: "", err: "invalid quantity"},
+	}
+	for _, tc := range tests {
+		if err := cli.ResetOptions(options); err != nil {
+			t.Fatalf("ResetOptions error %s", err)
+		}
+		_, err := cli.ParseOptions(options, []string{"--timeout=" + tc.arg})
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("ParseOptions(%q) error %v; want %q",
+					tc.arg, err, tc.err)
+			}
+			if !errors.Is(err, &cli.OptionError{Option: "timeout"}) {
+				t.Errorf("ParseOptions(%q) error %v isn't an"+
+					" OptionError for timeout", tc.arg, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseOptions(%q) error %s", tc.arg, err)
+			continue
+		}
+		if timeout != tc.want {
+			t.Errorf("ParseOptions(%q) set %g; want %g",
+				tc.arg, timeout, tc.want)
+		}
+	}
+}
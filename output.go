@@ -0,0 +1,68 @@
+// SPDX-FileCopyrightText: © 2021 Ulrich Kunitz
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"fmt"
+	"strings"
+)
+
+// outputFormats lists the formats supported by the option added by
+// AddOutputFormatOption. The first format is the default.
+var outputFormats = []string{"table", "json", "yaml"}
+
+// AddOutputFormatOption adds the persistent option --output or -o to the root
+// command, which selects the output format of all commands. The supported
+// formats are table, json and yaml; the default is table. The Exec functions
+// of the commands can get the selected format with OutputFormat. The function
+// returns false if the root command has already an option with the name
+// output or the short name o.
+func AddOutputFormatOption(root *Command) bool {
+	for _, o := range root.localOptions() {
+		if o.hasName("output") || o.hasShortString("o") {
+			return false
+		}
+	}
+	format := outputFormats[0]
+	opt := &Option{
+		Name:  "output",
+		Short: 'o',
+		Description: "output format; supported formats are " +
+			strings.Join(outputFormats, ", "),
+		HasParam:  true,
+		ParamType: strings.Join(outputFormats, "|"),
+		Default:   format,
+		SetValue: func(name, arg string, noParam bool) error {
+			for _, f := range outputFormats {
+				if arg == f {
+					format = arg
+					return nil
+				}
+			}
+			return &OptionError{
+				Option:     name,
+				Msg:        fmt.Sprintf("unsupported format %q", arg),
+				Suggestion: suggest(arg, outputFormats),
+			}
+		},
+		ResetValue: func() { format = outputFormats[0] },
+		GetValue:   func() interface{} { return format },
+	}
+	root.PersistentOptions = append(root.PersistentOptions, opt)
+	return true
+}
+
+// OutputFormat returns the format selected by the option --output in the
+// option list, usually the persistent options of the root command. It returns
+// an empty string if the list doesn't contain the option.
+func OutputFormat(options []*Option) string {
+	for _, o := range options {
+		if o.hasName("output") {
+			s, _ := o.StringValue()
+			return s
+		}
+	}
+	return ""
+}
@@ -0,0 +1,55 @@
+// SPDX-FileCopyrightText: © 2021 Ulrich Kunitz
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build cliplugin && cgo && (darwin || freebsd || linux)
+// +build cliplugin
+// +build cgo
+// +build darwin freebsd linux
+
+package cli
+
+import (
+	"fmt"
+	"plugin"
+)
+
+// PluginSymbol is the name of the function LoadPlugin looks up in a plugin. The
+// plugin must export it as
+//
+//	func Command() *cli.Command
+const PluginSymbol = "Command"
+
+// LoadPlugin opens the Go plugin at path and returns the command provided by
+// its function Command. The caller attaches it to the command tree, e.g. by
+// appending it to Subcommands or returning it from a SubcommandProvider.
+//
+// The function is only available if the program is built with the tag
+// cliplugin on Linux, FreeBSD or macOS with cgo enabled. The plugin must be
+// built with -buildmode=plugin by the same Go toolchain and with the same
+// versions of all packages shared with the program, including this one. A
+// plugin can't be unloaded. Loading it a second time reuses the shared object
+// kept by the Go runtime, but Command is called again and may return a new
+// command.
+func LoadPlugin(path string) (*Command, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	sym, err := p.Lookup(PluginSymbol)
+	if err != nil {
+		return nil, err
+	}
+	f, ok := sym.(func() *Command)
+	if !ok {
+		return nil, fmt.Errorf(
+			"cli: plugin %s: %s has type %T; want func() *cli.Command",
+			path, PluginSymbol, sym)
+	}
+	cmd := f()
+	if cmd == nil {
+		return nil, fmt.Errorf("cli: plugin %s: %s returned nil",
+			path, PluginSymbol)
+	}
+	return cmd, nil
+}
@@ -0,0 +1,24 @@
+// SPDX-FileCopyrightText: © 2021 Ulrich Kunitz
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build cliplugin && cgo && (darwin || freebsd || linux)
+// +build cliplugin
+// +build cgo
+// +build darwin freebsd linux
+
+package cli
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadPluginMissing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing.so")
+	cmd, err := LoadPlugin(path)
+	if err == nil {
+		t.Fatalf("LoadPlugin(%q) returned command %v without error",
+			path, cmd)
+	}
+}
@@ -0,0 +1,101 @@
+// SPDX-FileCopyrightText: © 2021 Ulrich Kunitz
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// readLine reads a line from r and removes the line ending. A last line
+// without line ending is returned without error.
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// readSecret reads a line from r with the echo of the terminal f disabled. The
+// line ending, which is not echoed, is written to out. If f is not a terminal,
+// the line is read normally.
+func readSecret(r *bufio.Reader, f *os.File, out io.Writer) (string, error) {
+	if f == nil || !IsTerminal(f.Fd()) {
+		return readLine(r)
+	}
+	restore, err := DisableEcho(f.Fd())
+	if err != nil {
+		return "", err
+	}
+	line, err := readLine(r)
+	if rerr := restore(); err == nil {
+		err = rerr
+	}
+	fmt.Fprintln(out)
+	return line, err
+}
+
+// PromptMissing prompts for the required options that haven't been set since
+// the last parse or reset. For every option the description and the option
+// name are written to out and a line is read from in. The line is handled
+// like a parameter given on the command line. An empty line leaves the option
+// unset. Values of secret options are read with the echo disabled if in is a
+// terminal. Errors setting a value are reported as OptionError.
+func PromptMissing(options []*Option, in io.Reader, out io.Writer) error {
+	f, _ := in.(*os.File)
+	r, ok := in.(*bufio.Reader)
+	if !ok {
+		r = bufio.NewReader(in)
+	}
+	for _, o := range options {
+		if !o.Required || o.seen {
+			continue
+		}
+		name := o.Name
+		if name == "" {
+			name = string(o.Short)
+		}
+		prompt := o.dashName(name)
+		if d := strings.Join(strings.Fields(o.Description), " "); d != "" {
+			prompt = fmt.Sprintf("%s (%s)", d, prompt)
+		}
+		if _, err := fmt.Fprintf(out, "%s: ", prompt); err != nil {
+			return err
+		}
+		var value string
+		var err error
+		if o.Secret {
+			value, err = readSecret(r, f, out)
+		} else {
+			value, err = readLine(r)
+		}
+		if err != nil {
+			return err
+		}
+		if value == "" {
+			continue
+		}
+		if err = o.set(sourcePrompt, name, value, false); err != nil {
+			return &OptionError{
+				Option: name,
+				Msg: fmt.Sprintf("error setting value %q for option %s",
+					value, o.dashName(name)),
+				Wrapped:    err,
+				Suggestion: suggestionOf(err),
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+// SPDX-FileCopyrightText: © 2021 Ulrich Kunitz
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli_test
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ulikunitz/cli"
+)
+
+func TestPromptMissing(t *testing.T) {
+	var token, user, output string
+	tokenOpt := cli.StringOption(&token, "token", 0, "access token")
+	tokenOpt.Required = true
+	userOpt := cli.StringOption(&user, "user", 'u', "")
+	userOpt.Required = true
+	outOpt := cli.StringOption(&output, "output", 'o', "output file")
+	options := []*cli.Option{tokenOpt, userOpt, outOpt}
+
+	if _, err := cli.ParseOptions(options, []string{"-u", "alice"}); err == nil {
+		t.Fatalf("ParseOptions without --token returned no error")
+	}
+	var sb strings.Builder
+	err := cli.PromptMissing(options, strings.NewReader("t0k3n\n"), &sb)
+	if err != nil {
+		t.Fatalf("PromptMissing error %s", err)
+	}
+	if token != "t0k3n" || user != "alice" || output != "" {
+		t.Fatalf("token %q user %q output %q; want %q %q %q",
+			token, user, output, "t0k3n", "alice", "")
+	}
+	const prompt = "access token (--token): "
+	if sb.String() != prompt {
+		t.Fatalf("PromptMissing wrote %q; want %q", sb.String(), prompt)
+	}
+
+	if err = cli.ResetOptions(options); err != nil {
+		t.Fatalf("ResetOptions error %s", err)
+	}
+	sb.Reset()
+	err = cli.PromptMissing(options, strings.NewReader("\nbob"), &sb)
+	if err != nil {
+		t.Fatalf("PromptMissing error %s", err)
+	}
+	if token != "" || user != "bob" {
+		t.Fatalf("token %q user %q; want %q %q", token, user, "", "bob")
+	}
+	const prompts = "access token (--token): --user: "
+	if sb.String() != prompts {
+		t.Fatalf("PromptMissing wrote %q; want %q", sb.String(), prompts)
+	}
+
+	err = cli.PromptMissing(options, strings.NewReader(""), io.Discard)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("PromptMissing at EOF returned %v; want %v", err,
+			io.ErrUnexpectedEOF)
+	}
+}
+
+func TestPromptMissingSecret(t *testing.T) {
+	password := "changeme"
+	opt := cli.StringOption(&password, "password", 0, "password")
+	opt.Required = true
+	opt.Secret = true
+	const usage = "--password=string"
+	if got := opt.Usage(); got != usage {
+		t.Fatalf("Usage returns %q; want %q", got, usage)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("os.Pipe error %s", err)
+	}
+	defer r.Close()
+	if _, err = io.WriteString(w, "s3cr3t\n"); err != nil {
+		t.Fatalf("WriteString error %s", err)
+	}
+	w.Close()
+	var sb strings.Builder
+	if err = cli.PromptMissing([]*cli.Option{opt}, r, &sb); err != nil {
+		t.Fatalf("PromptMissing error %s", err)
+	}
+	if password != "s3cr3t" {
+		t.Fatalf("password is %q; want %q", password, "s3cr3t")
+	}
+	if strings.Contains(sb.String(), "s3cr3t") {
+		t.Fatalf("PromptMissing wrote the secret: %q", sb.String())
+	}
+}
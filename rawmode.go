@@ -0,0 +1,79 @@
+// SPDX-FileCopyrightText: © 2021 Ulrich Kunitz
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build darwin || dragonfly || freebsd || (linux && !appengine) || netbsd || openbsd
+// +build darwin dragonfly freebsd linux,!appengine netbsd openbsd
+
+package cli
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+func getTermios(fd uintptr) (*syscall.Termios, error) {
+	var termios syscall.Termios
+	_, _, err := syscall.Syscall6(syscall.SYS_IOCTL, fd,
+		ioctlGetTermios, uintptr(unsafe.Pointer(&termios)), 0, 0, 0)
+	if err != 0 {
+		return nil, err
+	}
+	return &termios, nil
+}
+
+func setTermios(fd uintptr, termios *syscall.Termios) error {
+	_, _, err := syscall.Syscall6(syscall.SYS_IOCTL, fd,
+		ioctlSetTermios, uintptr(unsafe.Pointer(termios)), 0, 0, 0)
+	if err != 0 {
+		return err
+	}
+	return nil
+}
+
+// setTerminalMode modifies the terminal settings with f and returns a
+// function that restores the original settings.
+func setTerminalMode(fd uintptr, f func(t *syscall.Termios)) (restore func() error, err error) {
+	old, err := getTermios(fd)
+	if err != nil {
+		return nil, err
+	}
+	t := *old
+	f(&t)
+	if err = setTermios(fd, &t); err != nil {
+		return nil, err
+	}
+	return func() error { return setTermios(fd, old) }, nil
+}
+
+// MakeRaw puts the terminal identified by the file descriptor into raw mode.
+// Input is neither echoed nor processed and is available byte by byte. The
+// function restore returns the terminal into its original state.
+func MakeRaw(fd uintptr) (restore func() error, err error) {
+	return setTerminalMode(fd, func(t *syscall.Termios) {
+		t.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK |
+			syscall.ISTRIP | syscall.INLCR | syscall.IGNCR |
+			syscall.ICRNL | syscall.IXON
+		t.Oflag &^= syscall.OPOST
+		t.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON |
+			syscall.ISIG | syscall.IEXTEN
+		t.Cflag &^= syscall.CSIZE | syscall.PARENB
+		t.Cflag |= syscall.CS8
+		t.Cc[syscall.VMIN] = 1
+		t.Cc[syscall.VTIME] = 0
+	})
+}
+
+// DisableEcho switches off the echo of the terminal identified by the file
+// descriptor, while input is still processed line by line. It supports the
+// reading of passwords. The function restore switches the echo on again. Like
+// the one of MakeRaw it returns an error, because restoring the terminal
+// settings may fail, e.g. after the file has been closed, and a caller must be
+// able to report a terminal left without echo.
+func DisableEcho(fd uintptr) (restore func() error, err error) {
+	return setTerminalMode(fd, func(t *syscall.Termios) {
+		t.Lflag &^= syscall.ECHO
+		t.Lflag |= syscall.ICANON | syscall.ISIG
+		t.Iflag |= syscall.ICRNL
+	})
+}
@@ -0,0 +1,30 @@
+// SPDX-FileCopyrightText: © 2021 Ulrich Kunitz
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !darwin && !dragonfly && !freebsd && (!linux || appengine) && !netbsd && !openbsd && !windows
+// +build !darwin
+// +build !dragonfly
+// +build !freebsd
+// +build !linux appengine
+// +build !netbsd
+// +build !openbsd
+// +build !windows
+
+package cli
+
+import "errors"
+
+// errNoTerminal reports that the platform doesn't support terminal modes.
+var errNoTerminal = errors.New("cli: terminal modes not supported")
+
+// MakeRaw returns an error on platforms without terminal support.
+func MakeRaw(fd uintptr) (restore func() error, err error) {
+	return nil, errNoTerminal
+}
+
+// DisableEcho returns an error on platforms without terminal support, so that
+// secrets are not read with the echo on.
+func DisableEcho(fd uintptr) (restore func() error, err error) {
+	return nil, errNoTerminal
+}
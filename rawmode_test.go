@@ -0,0 +1,29 @@
+// SPDX-FileCopyrightText: © 2021 Ulrich Kunitz
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build darwin || dragonfly || freebsd || (linux && !appengine) || netbsd || openbsd
+// +build darwin dragonfly freebsd linux,!appengine netbsd openbsd
+
+package cli
+
+import (
+	"os"
+	"testing"
+)
+
+func TestMakeRawNoTerminal(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("os.Pipe error %s", err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	if _, err := MakeRaw(r.Fd()); err == nil {
+		t.Errorf("MakeRaw on pipe returned no error")
+	}
+	if _, err := DisableEcho(r.Fd()); err == nil {
+		t.Errorf("DisableEcho on pipe returned no error")
+	}
+}
@@ -0,0 +1,74 @@
+// SPDX-FileCopyrightText: © 2021 Ulrich Kunitz
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var setConsoleMode = kernel32.NewProc("SetConsoleMode")
+
+const (
+	enableProcessedInput       = 0x0001
+	enableLineInput            = 0x0002
+	enableEchoInput            = 0x0004
+	enableVirtualTerminalInput = 0x0200
+)
+
+func getMode(fd uintptr) (uint32, error) {
+	var st uint32
+	r, _, e := syscall.Syscall(getConsoleMode.Addr(),
+		2, fd, uintptr(unsafe.Pointer(&st)), 0)
+	if r == 0 {
+		return 0, e
+	}
+	return st, nil
+}
+
+func setMode(fd uintptr, st uint32) error {
+	r, _, e := syscall.Syscall(setConsoleMode.Addr(),
+		2, fd, uintptr(st), 0)
+	if r == 0 {
+		return e
+	}
+	return nil
+}
+
+// setTerminalMode modifies the console mode with f and returns a function that
+// restores the original mode.
+func setTerminalMode(fd uintptr, f func(st uint32) uint32) (restore func() error, err error) {
+	old, err := getMode(fd)
+	if err != nil {
+		return nil, err
+	}
+	if err = setMode(fd, f(old)); err != nil {
+		return nil, err
+	}
+	return func() error { return setMode(fd, old) }, nil
+}
+
+// MakeRaw puts the terminal identified by the file descriptor into raw mode.
+// Input is neither echoed nor processed and is available byte by byte. The
+// function restore returns the terminal into its original state.
+func MakeRaw(fd uintptr) (restore func() error, err error) {
+	return setTerminalMode(fd, func(st uint32) uint32 {
+		st &^= enableEchoInput | enableProcessedInput | enableLineInput
+		return st | enableVirtualTerminalInput
+	})
+}
+
+// DisableEcho switches off the echo of the terminal identified by the file
+// descriptor, while input is still processed line by line. It supports the
+// reading of passwords. The function restore switches the echo on again. Like
+// the one of MakeRaw it returns an error, because restoring the terminal
+// settings may fail, e.g. after the file has been closed, and a caller must be
+// able to report a terminal left without echo.
+func DisableEcho(fd uintptr) (restore func() error, err error) {
+	return setTerminalMode(fd, func(st uint32) uint32 {
+		st &^= enableEchoInput
+		return st | enableProcessedInput | enableLineInput
+	})
+}
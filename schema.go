@@ -0,0 +1,319 @@
+// SPDX-FileCopyrightText: © 2021 Ulrich Kunitz
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"unicode/utf8"
+)
+
+// optionSchema describes an option for form generation.
+type optionSchema struct {
+	Name            string      `json:"name,omitempty"`
+	Names           []string    `json:"names,omitempty"`
+	Shorts          []string    `json:"shorts,omitempty"`
+	Type            string      `json:"type"`
+	ParamType       string      `json:"paramType,omitempty"`
+	OptionalParam   bool        `json:"optionalParam,omitempty"`
+	Required        bool        `json:"required,omitempty"`
+	Choices         []string    `json:"choices,omitempty"`
+	Default         interface{} `json:"default,omitempty"`
+	DefaultTemplate string      `json:"defaultTemplate,omitempty"`
+	Description     string      `json:"description,omitempty"`
+}
+
+// commandSchema describes a command and its subcommands.
+type commandSchema struct {
+	Name              string          `json:"name"`
+	Names             []string        `json:"names,omitempty"`
+	Info              string          `json:"info,omitempty"`
+	Description       string          `json:"description,omitempty"`
+	Options           []optionSchema  `json:"options,omitempty"`
+	PersistentOptions []optionSchema  `json:"persistentOptions,omitempty"`
+	Subcommands       []commandSchema `json:"subcommands,omitempty"`
+}
+
+// schemaType returns the JSON schema type for the option. Options created by
+// CountOption are integers without parameter type.
+func schemaType(opt *Option) string {
+	if !opt.HasParam {
+		if _, ok := opt.IntValue(); ok {
+			return "integer"
+		}
+		return "boolean"
+	}
+	switch opt.ParamType {
+	case "int", "int64", "uint", "uint64":
+		return "integer"
+	case "float64":
+		return "number"
+	}
+	return "string"
+}
+
+// schemaDefault converts the default of the option to the JSON type. The
+// defaults of secret options and of options hiding their default are omitted
+// like in the usage information.
+func schemaDefault(opt *Option, typ string) interface{} {
+	if opt.Default == "" || opt.HideDefault || opt.Secret {
+		return nil
+	}
+	switch typ {
+	case "integer":
+		if i, err := strconv.ParseInt(opt.Default, 0, 64); err == nil {
+			return i
+		}
+	case "number":
+		if x, err := strconv.ParseFloat(opt.Default, 64); err == nil {
+			return x
+		}
+	case "boolean":
+		if b, err := parseBool(opt.Default); err == nil {
+			return b
+		}
+	}
+	return opt.Default
+}
+
+func newOptionSchemas(options []*Option) []optionSchema {
+	if len(options) == 0 {
+		return nil
+	}
+	schemas := make([]optionSchema, 0, len(options))
+	for _, opt := range options {
+		s := optionSchema{
+			Name:            opt.Name,
+			Names:           opt.Names,
+			Type:            schemaType(opt),
+			OptionalParam:   opt.OptionalParam,
+			Required:        opt.Required,
+			Choices:         opt.choices,
+			DefaultTemplate: opt.DefaultTemplate,
+			Description:     opt.Description,
+		}
+		if opt.HasParam {
+			s.ParamType = opt.ParamType
+		}
+		s.Default = schemaDefault(opt, s.Type)
+		for _, r := range opt.AllShorts() {
+			s.Shorts = append(s.Shorts, string(r))
+		}
+		schemas = append(schemas, s)
+	}
+	return schemas
+}
+
+func newCommandSchema(cmd *Command) commandSchema {
+	s := commandSchema{
+		Name:              cmd.Name,
+		Names:             cmd.Names,
+		Info:              cmd.Info,
+		Description:       cmd.Description,
+		Options:           newOptionSchemas(cmd.Options),
+		PersistentOptions: newOptionSchemas(cmd.PersistentOptions),
+	}
+	cmd.loadSubcommands()
+	for _, c := range cmd.Subcommands {
+		s.Subcommands = append(s.Subcommands, newCommandSchema(c))
+	}
+	return s
+}
+
+// OptionsSchema returns a JSON description of the command tree with all
+// options. Each option is described by its names, its JSON type (boolean,
+// integer, number or string), the parameter type, whether it is required, the
+// choices of an EnumOption, its default and its description. Count options are
+// integers without parameter type. Defaults that the usage information hides
+// are omitted. The description is intended for the generation of forms in
+// graphical front ends.
+func OptionsSchema(root *Command) []byte {
+	data, err := json.MarshalIndent(newCommandSchema(root), "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+// newOptionFromSchema creates the option described by s. The value of the
+// option is stored in a variable owned by the option.
+func newOptionFromSchema(s *optionSchema) (opt *Option, err error) {
+	var shorts []rune
+	for _, short := range s.Shorts {
+		r, size := utf8.DecodeRuneInString(short)
+		if size == 0 || size != len(short) {
+			return nil, fmt.Errorf("invalid short option %q", short)
+		}
+		if err = verifyShort(r); err != nil {
+			return nil, err
+		}
+		shorts = append(shorts, r)
+	}
+	if s.Name == "" && len(s.Names) == 0 && len(shorts) == 0 {
+		return nil, fmt.Errorf("option without name")
+	}
+	var short rune
+	if len(shorts) > 0 {
+		short = shorts[0]
+	}
+	invalidDefault := func() error {
+		return fmt.Errorf("invalid default %v for %s option %s",
+			s.Default, s.Type, s.Name)
+	}
+	switch s.Type {
+	case "boolean":
+		b := new(bool)
+		opt = BoolOption(b, s.Name, short, s.Description)
+		if s.Default != nil {
+			def, ok := s.Default.(bool)
+			if !ok {
+				return nil, invalidDefault()
+			}
+			if def {
+				*b = true
+				opt.Default = "true"
+				opt.ResetValue = func() { *b = true }
+			}
+		}
+	case "integer":
+		var x float64
+		if s.Default != nil {
+			var ok bool
+			if x, ok = s.Default.(float64); !ok || x != math.Trunc(x) {
+				return nil, invalidDefault()
+			}
+		}
+		switch s.ParamType {
+		case "":
+			n := new(int)
+			opt = CountOption(n, s.Name, short, s.Description)
+			if x != 0 {
+				return nil, invalidDefault()
+			}
+		case "int64":
+			n := new(int64)
+			if *n = int64(x); float64(*n) != x {
+				return nil, invalidDefault()
+			}
+			opt = Int64Option(n, s.Name, short, s.Description)
+		case "uint":
+			n := new(uint)
+			if *n = uint(x); x < 0 || float64(*n) != x {
+				return nil, invalidDefault()
+			}
+			opt = UintOption(n, s.Name, short, s.Description)
+		case "uint64":
+			n := new(uint64)
+			if *n = uint64(x); x < 0 || float64(*n) != x {
+				return nil, invalidDefault()
+			}
+			opt = Uint64Option(n, s.Name, short, s.Description)
+		default:
+			n := new(int)
+			if *n = int(x); float64(*n) != x {
+				return nil, invalidDefault()
+			}
+			opt = IntOption(n, s.Name, short, s.Description)
+		}
+	case "number":
+		x := new(float64)
+		if s.Default != nil {
+			var ok bool
+			if *x, ok = s.Default.(float64); !ok {
+				return nil, invalidDefault()
+			}
+		}
+		opt = Float64Option(x, s.Name, short, s.Description)
+	case "string":
+		str := new(string)
+		if s.Default != nil {
+			var ok bool
+			if *str, ok = s.Default.(string); !ok {
+				return nil, invalidDefault()
+			}
+		}
+		switch {
+		case len(s.Choices) > 0:
+			opt = EnumOption(str, s.Choices, s.Name, short,
+				s.Description)
+		case s.ParamType == "path":
+			opt = PathOption(str, s.Name, short, s.Description)
+		default:
+			opt = StringOption(str, s.Name, short, s.Description)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported type %q for option %s",
+			s.Type, s.Name)
+	}
+	opt.Names = s.Names
+	opt.Required = s.Required
+	opt.DefaultTemplate = s.DefaultTemplate
+	if len(shorts) > 1 {
+		opt.Shorts = shorts[1:]
+	}
+	if opt.HasParam {
+		opt.OptionalParam = s.OptionalParam
+		if s.ParamType != "" {
+			opt.ParamType = s.ParamType
+		}
+	}
+	return opt, nil
+}
+
+func newOptionsFromSchemas(schemas []optionSchema) ([]*Option, error) {
+	var options []*Option
+	for i := range schemas {
+		opt, err := newOptionFromSchema(&schemas[i])
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, opt)
+	}
+	return options, nil
+}
+
+func newCommandFromSchema(s *commandSchema) (cmd *Command, err error) {
+	if s.Name == "" {
+		return nil, fmt.Errorf("command without name")
+	}
+	cmd = &Command{
+		Name:        s.Name,
+		Names:       s.Names,
+		Info:        s.Info,
+		Description: s.Description,
+	}
+	if cmd.Options, err = newOptionsFromSchemas(s.Options); err != nil {
+		return nil, &CommandError{Name: s.Name, Wrapped: err}
+	}
+	cmd.PersistentOptions, err = newOptionsFromSchemas(s.PersistentOptions)
+	if err != nil {
+		return nil, &CommandError{Name: s.Name, Wrapped: err}
+	}
+	for i := range s.Subcommands {
+		c, err := newCommandFromSchema(&s.Subcommands[i])
+		if err != nil {
+			return nil, err
+		}
+		cmd.Subcommands = append(cmd.Subcommands, c)
+	}
+	return cmd, nil
+}
+
+// BuildCommand creates a command tree from a JSON specification in the format
+// produced by OptionsSchema. The options are created by the constructors of
+// this package matching their types; integers use the constructor for their
+// parameter type, e.g. UintOption for uint, and CountOption if they have
+// none. Their values can be obtained with
+// the Value method of the options after parsing. The Exec functions must be
+// attached to the commands afterwards; the commands can be found with Parse.
+func BuildCommand(spec []byte) (*Command, error) {
+	var s commandSchema
+	if err := json.Unmarshal(spec, &s); err != nil {
+		return nil, err
+	}
+	return newCommandFromSchema(&s)
+}
@@ -0,0 +1,68 @@
+// SPDX-FileCopyrightText: © 2021 Ulrich Kunitz
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// StatusLine reports progress on a single terminal line, which is rewritten by
+// every update. If the output is not a terminal, nothing is written, so that
+// progress messages don't clutter files or pipes. Messages should be shorter
+// than the terminal line; they are not truncated.
+type StatusLine struct {
+	w        io.Writer
+	terminal bool
+	// n is the width of the current status message in terminal cells.
+	n int
+}
+
+// NewStatusLine creates a status line writing to w. The file descriptor fd of
+// the output is used to check whether w is a terminal.
+func NewStatusLine(w io.Writer, fd uintptr) *StatusLine {
+	return &StatusLine{w: w, terminal: IsTerminal(fd)}
+}
+
+// Update replaces the current status message by msg. Only the first line of
+// msg is used.
+func (s *StatusLine) Update(msg string) error {
+	if !s.terminal {
+		return nil
+	}
+	if i := strings.IndexAny(msg, "\r\n"); i >= 0 {
+		msg = msg[:i]
+	}
+	k := DisplayWidth(msg)
+	pad := ""
+	if k < s.n {
+		pad = strings.Repeat(" ", s.n-k) + strings.Repeat("\b", s.n-k)
+	}
+	s.n = k
+	_, err := fmt.Fprintf(s.w, "\r%s%s", msg, pad)
+	return err
+}
+
+// Clear removes the status message from the line.
+func (s *StatusLine) Clear() error {
+	if !s.terminal || s.n == 0 {
+		return nil
+	}
+	_, err := fmt.Fprintf(s.w, "\r%s\r", strings.Repeat(" ", s.n))
+	s.n = 0
+	return err
+}
+
+// Done terminates the status line with a newline, so that the last message
+// stays visible. Further updates start a new line.
+func (s *StatusLine) Done() error {
+	if !s.terminal || s.n == 0 {
+		return nil
+	}
+	s.n = 0
+	_, err := fmt.Fprintln(s.w)
+	return err
+}
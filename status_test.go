@@ -0,0 +1,65 @@
+// SPDX-FileCopyrightText: © 2021 Ulrich Kunitz
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build darwin || dragonfly || freebsd || (linux && !appengine) || netbsd || openbsd || windows
+// +build darwin dragonfly freebsd linux,!appengine netbsd openbsd windows
+
+package cli
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestStatusLine(t *testing.T) {
+	var sb strings.Builder
+	s := &StatusLine{w: &sb, terminal: true}
+	for _, msg := range []string{"10%", "100% done", "ok\nignored"} {
+		if err := s.Update(msg); err != nil {
+			t.Fatalf("Update(%q) error %s", msg, err)
+		}
+	}
+	if err := s.Done(); err != nil {
+		t.Fatalf("Done error %s", err)
+	}
+	const want = "\r10%\r100% done\rok       \b\b\b\b\b\b\b\n"
+	if got := sb.String(); got != want {
+		t.Fatalf("got %q; want %q", got, want)
+	}
+}
+
+func TestStatusLineWide(t *testing.T) {
+	var sb strings.Builder
+	s := &StatusLine{w: &sb, terminal: true}
+	for _, msg := range []string{"一覧 ok", "x"} {
+		if err := s.Update(msg); err != nil {
+			t.Fatalf("Update(%q) error %s", msg, err)
+		}
+	}
+	if err := s.Clear(); err != nil {
+		t.Fatalf("Clear error %s", err)
+	}
+	const want = "\r一覧 ok\rx      \b\b\b\b\b\b\r \r"
+	if got := sb.String(); got != want {
+		t.Fatalf("got %q; want %q", got, want)
+	}
+}
+
+func TestStatusLineNoTerminal(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("os.Pipe error %s", err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	var sb strings.Builder
+	s := NewStatusLine(&sb, w.Fd())
+	s.Update("50%")
+	s.Done()
+	if sb.Len() != 0 {
+		t.Fatalf("status line wrote %q to a pipe", sb.String())
+	}
+}
@@ -0,0 +1,53 @@
+// SPDX-FileCopyrightText: © 2021 Ulrich Kunitz
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+// editDistance computes the Levenshtein distance between the strings a and b
+// counted in runes.
+func editDistance(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	d := make([]int, len(t)+1)
+	for j := range d {
+		d[j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		prev := d[0]
+		d[0] = i
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			x := minInt(d[j]+1, d[j-1]+1)
+			x = minInt(x, prev+cost)
+			prev, d[j] = d[j], x
+		}
+	}
+	return d[len(t)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// suggest returns the candidate nearest to arg if it is close enough to be a
+// likely correction of a typo. It returns an empty string otherwise.
+func suggest(arg string, candidates []string) string {
+	limit := len([]rune(arg)) / 3
+	if limit < 1 {
+		limit = 1
+	}
+	best, bestDist := "", limit+1
+	for _, c := range candidates {
+		d := editDistance(arg, c)
+		if d > 0 && d < bestDist {
+			best, bestDist = c, d
+		}
+	}
+	return best
+}
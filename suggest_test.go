@@ -0,0 +1,47 @@
+// SPDX-FileCopyrightText: © 2021 Ulrich Kunitz
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import "testing"
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		d    int
+	}{
+		{"", "", 0},
+		{"json", "json", 0},
+		{"jsonn", "json", 1},
+		{"", "abc", 3},
+		{"kitten", "sitting", 3},
+		{"yml", "yaml", 1},
+		{"äbc", "abc", 1},
+	}
+	for _, tc := range tests {
+		if d := editDistance(tc.a, tc.b); d != tc.d {
+			t.Errorf("editDistance(%q, %q) = %d; want %d",
+				tc.a, tc.b, d, tc.d)
+		}
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	candidates := []string{"json", "yaml", "table"}
+	tests := []struct {
+		arg  string
+		want string
+	}{
+		{"jsonn", "json"},
+		{"yml", "yaml"},
+		{"tabel", ""},
+		{"xml", ""},
+		{"json", ""},
+	}
+	for _, tc := range tests {
+		if s := suggest(tc.arg, candidates); s != tc.want {
+			t.Errorf("suggest(%q) = %q; want %q", tc.arg, s, tc.want)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+// SPDX-FileCopyrightText: © 2021 Ulrich Kunitz
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// TemplateContext is the data a DefaultTemplate of an option is executed
+// with.
+type TemplateContext struct {
+	// Home is the home directory of the user or an empty string if it
+	// cannot be determined.
+	Home string
+	// Env maps the names of the environment variables to their values.
+	Env map[string]string
+	// Options maps the long names of the options without default
+	// template to their values after the reset by ResetOptions or the
+	// parse. It is empty if a single option is reset.
+	Options map[string]interface{}
+}
+
+// newTemplateContext creates the context for the default templates of the
+// options. The values of the options are taken after their reset or parse.
+func newTemplateContext(options []*Option) *TemplateContext {
+	ctx := &TemplateContext{
+		Env:     make(map[string]string),
+		Options: make(map[string]interface{}),
+	}
+	ctx.Home, _ = os.UserHomeDir()
+	for _, kv := range os.Environ() {
+		if i := strings.IndexByte(kv, '='); i > 0 {
+			ctx.Env[kv[:i]] = kv[i+1:]
+		}
+	}
+	for _, o := range options {
+		if o.Name != "" && o.DefaultTemplate == "" {
+			ctx.Options[o.Name] = o.Value()
+		}
+	}
+	return ctx
+}
+
+// evalDefaultTemplate executes the default template of the option.
+func (opt *Option) evalDefaultTemplate(ctx *TemplateContext) (string, error) {
+	name := opt.Name
+	if name == "" {
+		name = string(opt.Short)
+	}
+	t, err := template.New(name).Option("missingkey=error").Parse(
+		opt.DefaultTemplate)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	if err = t.Execute(&sb, ctx); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// applyDefaultTemplate sets the option to the value of its default template.
+// Nothing happens if the option has no template.
+func (opt *Option) applyDefaultTemplate(ctx *TemplateContext) error {
+	if opt.DefaultTemplate == "" {
+		return nil
+	}
+	name := opt.Name
+	if name == "" {
+		name = string(opt.Short)
+	}
+	value, err := opt.evalDefaultTemplate(ctx)
+	if err != nil {
+		return &OptionError{
+			Option: name,
+			Msg: fmt.Sprintf("invalid default template for option %s",
+				opt.dashName(name)),
+			Wrapped: err,
+		}
+	}
+	if err = opt.SetValue(resetName, value, false); err != nil {
+		return &OptionError{
+			Option: name,
+			Msg: fmt.Sprintf(
+				"error setting default %q for option %s",
+				value, opt.dashName(name)),
+			Wrapped: err,
+		}
+	}
+	return nil
+}
+
+// applyDefaultTemplates sets the options with default template that haven't
+// been set since the last parse or reset to the values of their templates.
+func applyDefaultTemplates(options []*Option) error {
+	ctx := newTemplateContext(options)
+	var errList errorList
+	for _, o := range options {
+		if o.seen {
+			continue
+		}
+		if err := o.applyDefaultTemplate(ctx); err != nil {
+			errList = append(errList, err)
+		}
+	}
+	return errList.Flatten()
+}
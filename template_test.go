@@ -0,0 +1,119 @@
+// SPDX-FileCopyrightText: © 2021 Ulrich Kunitz
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli_test
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ulikunitz/cli"
+)
+
+func TestDefaultTemplate(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skipf("no home directory: %s", err)
+	}
+	os.Setenv("CLI_TEST_TEMPLATE", "debug")
+	defer os.Unsetenv("CLI_TEST_TEMPLATE")
+
+	dir := "/var/lib/foo"
+	var logPath, level, cache string
+	logOpt := cli.StringOption(&logPath, "log", 0, "log file")
+	logOpt.DefaultTemplate = "{{.Home}}/.foo/log"
+	levelOpt := cli.StringOption(&level, "level", 0, "log level")
+	levelOpt.DefaultTemplate = "{{.Env.CLI_TEST_TEMPLATE}}"
+	cacheOpt := cli.StringOption(&cache, "cache", 0, "cache directory")
+	cacheOpt.DefaultTemplate = `{{index .Options "dir"}}/cache`
+	options := []*cli.Option{
+		logOpt, levelOpt, cacheOpt,
+		cli.StringOption(&dir, "dir", 0, "data directory"),
+	}
+
+	if err = cli.ResetOptions(options); err != nil {
+		t.Fatalf("ResetOptions error %s", err)
+	}
+	if want := home + "/.foo/log"; logPath != want {
+		t.Errorf("log is %q; want %q", logPath, want)
+	}
+	if level != "debug" {
+		t.Errorf("level is %q; want %q", level, "debug")
+	}
+	if cache != "/var/lib/foo/cache" {
+		t.Errorf("cache is %q; want %q", cache, "/var/lib/foo/cache")
+	}
+	want := "--log=string (default " + home + "/.foo/log)"
+	if got := logOpt.Usage(); got != want {
+		t.Errorf("Usage returns %q; want %q", got, want)
+	}
+
+	if _, err = cli.ParseOptions(options, []string{"--log=x.log"}); err != nil {
+		t.Fatalf("ParseOptions error %s", err)
+	}
+	if err = logOpt.Reset(); err != nil {
+		t.Fatalf("Reset error %s", err)
+	}
+	if want := home + "/.foo/log"; logPath != want {
+		t.Errorf("log is %q after Reset; want %q", logPath, want)
+	}
+
+	tests := []struct {
+		tmpl string
+		msg  string
+	}{
+		{"{{.Home", "unclosed action"},
+		{"{{.Env.CLI_TEST_UNDEFINED}}", "CLI_TEST_UNDEFINED"},
+		{"{{.Nothing}}", "Nothing"},
+	}
+	for _, tc := range tests {
+		levelOpt.DefaultTemplate = tc.tmpl
+		err = cli.ResetOptions(options)
+		if !errors.Is(err, &cli.OptionError{Option: "level"}) {
+			t.Errorf("template %q: error %v; want error for level",
+				tc.tmpl, err)
+			continue
+		}
+		if !strings.Contains(err.Error(),
+			"invalid default template for option --level") ||
+			!strings.Contains(err.Error(), tc.msg) {
+			t.Errorf("template %q: error %q", tc.tmpl, err)
+		}
+	}
+}
+
+func TestDefaultTemplateRun(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skipf("no home directory: %s", err)
+	}
+	var dir, cache string
+	dirOpt := cli.StringOption(&dir, "dir", 0, "data directory")
+	dirOpt.DefaultTemplate = "/x/{{.Home}}"
+	cacheOpt := cli.StringOption(&cache, "cache", 0, "cache directory")
+	cacheOpt.DefaultTemplate = "/y/{{.Home}}"
+	var got string
+	root := &cli.Command{
+		Name:    "foo",
+		Options: []*cli.Option{dirOpt, cacheOpt},
+		Exec: func(args []string) error {
+			got = dir
+			return nil
+		},
+	}
+	if err = cli.Run(root, []string{"--cache", "/tmp"}); err != nil {
+		t.Fatalf("Run error %s", err)
+	}
+	if want := "/x/" + home; got != want {
+		t.Errorf("dir is %q; want %q", got, want)
+	}
+	if want := "--dir=string (default /x/" + home + ")"; dirOpt.Usage() != want {
+		t.Errorf("Usage returns %q; want %q", dirOpt.Usage(), want)
+	}
+	if cache != "/tmp" {
+		t.Errorf("cache is %q; want the command line value", cache)
+	}
+}
@@ -0,0 +1,34 @@
+// SPDX-FileCopyrightText: © 2021 Ulrich Kunitz
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"io"
+	"os"
+)
+
+// IsTerminalFile returns true if the file is a terminal.
+func IsTerminalFile(f *os.File) bool {
+	if f == nil {
+		return false
+	}
+	return IsTerminal(f.Fd())
+}
+
+// IsTerminalWriter returns true if w is an *os.File and a terminal.
+func IsTerminalWriter(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	return IsTerminalFile(f)
+}
+
+// StdinIsPiped returns true if standard input is not a terminal, which is the
+// case if input is piped or redirected from a file. Commands may use it to
+// decide between reading input and prompting the user.
+func StdinIsPiped() bool {
+	return !IsTerminalFile(os.Stdin)
+}
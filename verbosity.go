@@ -0,0 +1,68 @@
+// SPDX-FileCopyrightText: © 2021 Ulrich Kunitz
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// Verbosity levels reported by Verbosity.Level.
+const (
+	LevelQuiet   = -1
+	LevelNormal  = 0
+	LevelVerbose = 1
+	LevelDebug   = 2
+)
+
+// Verbosity provides the verbosity level selected by the options -v and -q.
+// Each -v increases the level, -q selects LevelQuiet and takes precedence.
+type Verbosity struct {
+	// Output receives the messages of Printf. If it is nil, messages are
+	// written to os.Stderr.
+	Output io.Writer
+
+	count int
+	quiet bool
+}
+
+// Level returns the verbosity level.
+func (v *Verbosity) Level() int {
+	if v.quiet {
+		return LevelQuiet
+	}
+	return v.count
+}
+
+// Printf writes the message if level doesn't exceed the current verbosity
+// level. Messages with LevelNormal are suppressed only by -q. A newline is
+// appended if the message doesn't end with one.
+func (v *Verbosity) Printf(level int, format string, a ...interface{}) {
+	if level > v.Level() {
+		return
+	}
+	w := v.Output
+	if w == nil {
+		w = os.Stderr
+	}
+	s := fmt.Sprintf(format, a...)
+	if len(s) == 0 || s[len(s)-1] != '\n' {
+		s += "\n"
+	}
+	io.WriteString(w, s)
+}
+
+// AddVerbosityOptions adds the persistent options --verbose/-v and --quiet/-q
+// to the root command and returns the Verbosity controlled by them. The
+// option --verbose can be repeated to increase the level.
+func AddVerbosityOptions(root *Command) *Verbosity {
+	v := new(Verbosity)
+	root.PersistentOptions = append(root.PersistentOptions,
+		CountOption(&v.count, "verbose", 'v',
+			"increases the verbosity; may be repeated"),
+		BoolOption(&v.quiet, "quiet", 'q', "suppresses messages"))
+	return v
+}
@@ -0,0 +1,90 @@
+// SPDX-FileCopyrightText: © 2021 Ulrich Kunitz
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"fmt"
+	"runtime/debug"
+	"strings"
+)
+
+// addVersionOption adds the option --version to the root command, which
+// prints the string returned by version. The option is immediate, so it works
+// even if required options are missing.
+func addVersionOption(root *Command, version func() string) bool {
+	for _, o := range root.localOptions() {
+		if o.hasName("version") {
+			return false
+		}
+	}
+	opt := &Option{
+		Name:        "version",
+		Description: "prints version information",
+		Immediate:   true,
+		SetValue: func(name, arg string, noParam bool) error {
+			_, err := fmt.Fprintf(root.output(), "%s %s\n", root.Name,
+				version())
+			return err
+		},
+		ResetValue: func() {},
+	}
+	root.Options = append(root.Options, opt)
+	return true
+}
+
+// AddVersionOption adds the option --version to the root command, which
+// prints the name of the command and the Version field. It returns false if
+// the command has already a version option.
+func AddVersionOption(root *Command) bool {
+	return addVersionOption(root, func() string { return root.Version })
+}
+
+// AddBuildInfoVersionOption adds a version option like AddVersionOption, but
+// the option prints the build information embedded in the binary by the Go
+// toolchain: the module version, the module path, the VCS revision and time
+// and the Go version. The Version field is used if the module version is not
+// known, which is the case for binaries not built with go install
+// module@version.
+func AddBuildInfoVersionOption(root *Command) bool {
+	return addVersionOption(root, func() string {
+		info, ok := debug.ReadBuildInfo()
+		return buildInfoVersion(root.Version, info, ok)
+	})
+}
+
+// buildInfoVersion creates the version string from the build information.
+func buildInfoVersion(version string, info *debug.BuildInfo, ok bool) string {
+	if !ok {
+		return version
+	}
+	if v := info.Main.Version; v != "" && v != "(devel)" {
+		version = v
+	}
+	if version == "" {
+		version = "(devel)"
+	}
+	var sb strings.Builder
+	sb.WriteString(version)
+	if info.Main.Path != "" {
+		fmt.Fprintf(&sb, "\nmodule: %s", info.Main.Path)
+	}
+	settings := make(map[string]string)
+	for _, s := range info.Settings {
+		settings[s.Key] = s.Value
+	}
+	if rev := settings["vcs.revision"]; rev != "" {
+		if settings["vcs.modified"] == "true" {
+			rev += " (modified)"
+		}
+		fmt.Fprintf(&sb, "\nrevision: %s", rev)
+	}
+	if t := settings["vcs.time"]; t != "" {
+		fmt.Fprintf(&sb, "\ntime: %s", t)
+	}
+	if info.GoVersion != "" {
+		fmt.Fprintf(&sb, "\ngo: %s", info.GoVersion)
+	}
+	return sb.String()
+}
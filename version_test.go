@@ -0,0 +1,43 @@
+// SPDX-FileCopyrightText: © 2021 Ulrich Kunitz
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"runtime/debug"
+	"testing"
+)
+
+func TestBuildInfoVersion(t *testing.T) {
+	info := &debug.BuildInfo{
+		GoVersion: "go1.22.0",
+		Main:      debug.Module{Path: "example.com/foo", Version: "v1.2.3"},
+		Settings: []debug.BuildSetting{
+			{Key: "vcs.revision", Value: "abc123"},
+			{Key: "vcs.time", Value: "2024-01-02T03:04:05Z"},
+			{Key: "vcs.modified", Value: "true"},
+		},
+	}
+	tests := []struct {
+		version string
+		info    *debug.BuildInfo
+		ok      bool
+		want    string
+	}{
+		{"1.0", nil, false, "1.0"},
+		{"1.0", info, true, "v1.2.3\nmodule: example.com/foo\n" +
+			"revision: abc123 (modified)\n" +
+			"time: 2024-01-02T03:04:05Z\ngo: go1.22.0"},
+		{"1.0", &debug.BuildInfo{Main: debug.Module{Version: "(devel)"}},
+			true, "1.0"},
+		{"", &debug.BuildInfo{}, true, "(devel)"},
+	}
+	for _, tc := range tests {
+		got := buildInfoVersion(tc.version, tc.info, tc.ok)
+		if got != tc.want {
+			t.Errorf("buildInfoVersion(%q) = %q; want %q",
+				tc.version, got, tc.want)
+		}
+	}
+}
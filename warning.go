@@ -0,0 +1,41 @@
+// SPDX-FileCopyrightText: © 2021 Ulrich Kunitz
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+var (
+	warningMutex sync.Mutex
+	// warnings records the warnings already printed.
+	warnings = make(map[string]bool)
+	// warningOutput receives the warnings.
+	warningOutput io.Writer = os.Stderr
+)
+
+// warnOnce prints the warning message to standard error, but only once per
+// process.
+func warnOnce(msg string) {
+	warningMutex.Lock()
+	defer warningMutex.Unlock()
+	if warnings[msg] {
+		return
+	}
+	warnings[msg] = true
+	fmt.Fprintf(warningOutput, "warning: %s\n", msg)
+}
+
+// ResetWarnings forgets the warnings printed so far, so that each of them will
+// be printed again. Deprecation warnings are printed only once per process by
+// default.
+func ResetWarnings() {
+	warningMutex.Lock()
+	defer warningMutex.Unlock()
+	warnings = make(map[string]bool)
+}
@@ -0,0 +1,45 @@
+// SPDX-FileCopyrightText: © 2021 Ulrich Kunitz
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDeprecationWarning(t *testing.T) {
+	var sb strings.Builder
+	output := warningOutput
+	warningOutput = &sb
+	defer func() {
+		warningOutput = output
+		ResetWarnings()
+	}()
+
+	var f bool
+	opt := BoolOption(&f, "old", 'o', "old option")
+	opt.Deprecated = "use --new instead"
+	opts := []*Option{opt}
+
+	for i := 0; i < 3; i++ {
+		if _, err := ParseOptions(opts, []string{"--old", "-o"}); err != nil {
+			t.Fatalf("ParseOptions error %s", err)
+		}
+	}
+	const want = "warning: option --old is deprecated; use --new instead\n" +
+		"warning: option -o is deprecated; use --new instead\n"
+	if got := sb.String(); got != want {
+		t.Fatalf("got warnings %q; want %q", got, want)
+	}
+
+	ResetWarnings()
+	if _, err := ParseOptions(opts, []string{"--old"}); err != nil {
+		t.Fatalf("ParseOptions error %s", err)
+	}
+	if got := strings.Count(sb.String(), "--old"); got != 2 {
+		t.Fatalf("got %d warnings for --old after reset; want %d",
+			got, 2)
+	}
+}
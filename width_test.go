@@ -0,0 +1,64 @@
+// SPDX-FileCopyrightText: © 2021 Ulrich Kunitz
+//
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ulikunitz/cli"
+)
+
+func TestDisplayWidth(t *testing.T) {
+	tests := []struct {
+		s string
+		n int
+	}{
+		{"", 0},
+		{"list", 4},
+		{"größe", 5},
+		{"é", 1},
+		{"一覧", 4},
+		{"목록", 4},
+		{"ｌｓ", 4},
+		{"🚀x", 3},
+		{"a\tb", 2},
+	}
+	for _, tc := range tests {
+		if n := cli.DisplayWidth(tc.s); n != tc.n {
+			t.Errorf("DisplayWidth(%q) = %d; want %d", tc.s, n, tc.n)
+		}
+	}
+}
+
+func TestWriteDocWideNames(t *testing.T) {
+	root := &cli.Command{
+		Name: "foo",
+		Subcommands: []*cli.Command{
+			{Name: "一覧", Info: "list"},
+			{Name: "add", Info: "add"},
+			{Name: "löschen", Info: "delete"},
+		},
+	}
+	var sb strings.Builder
+	if _, err := root.WriteDoc(&sb); err != nil {
+		t.Fatalf("WriteDoc error %s", err)
+	}
+	col := -1
+	for _, line := range strings.Split(sb.String(), "\n") {
+		i := strings.Index(line, "- ")
+		if i < 0 {
+			continue
+		}
+		w := cli.DisplayWidth(line[:i])
+		if col >= 0 && w != col {
+			t.Fatalf("info not aligned:\n%s", sb.String())
+		}
+		col = w
+	}
+	if col < 0 {
+		t.Fatalf("no subcommands found:\n%s", sb.String())
+	}
+}